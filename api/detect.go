@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Detect reports whether an avatar already carries the badge.
+func Detect(w http.ResponseWriter, r *http.Request) {
+	avatar.Detect(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Callback completes the Mastodon sign in.
+func Callback(w http.ResponseWriter, r *http.Request) {
+	avatar.MastodonCallback(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Follows starts find-my-follows jobs and reports on them.
+func Follows(w http.ResponseWriter, r *http.Request) {
+	avatar.Follows(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Healthz reports the process is up.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	avatar.Healthz(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// ListReport reports how far the members of a Twitter List have moved.
+func ListReport(w http.ResponseWriter, r *http.Request) {
+	avatar.ListReport(w, r)
+}
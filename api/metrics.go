@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Metrics exposes Prometheus metrics.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	avatar.Metrics(w, r)
+}
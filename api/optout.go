@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// OptOut is the self-service opt-out.
+func OptOut(w http.ResponseWriter, r *http.Request) {
+	avatar.OptOut(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Profile returns a Twitter profile and the Fediverse handles found in it.
+func Profile(w http.ResponseWriter, r *http.Request) {
+	avatar.Profile(w, r)
+}
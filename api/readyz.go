@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Readyz reports whether the service can render.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	avatar.Readyz(w, r)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+// Login signs in with Twitter to apply the badged avatar.
+func Login(w http.ResponseWriter, r *http.Request) {
+	avatar.TwitterLogin(w, r)
+}
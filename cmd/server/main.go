@@ -0,0 +1,66 @@
+// Command server runs the avatar endpoints as a standalone HTTP server, for
+// local runs and deployments outside Vercel.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/internal/avatar"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	flag.Parse()
+
+	//fail fast on a bad config instead of on the first request
+	if err := avatar.ConfigError(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/mastodon", avatar.Handler)
+	mux.HandleFunc("/api/optout", avatar.OptOut)
+	mux.HandleFunc("/api/profile", avatar.Profile)
+	mux.HandleFunc("/api/follows", avatar.Follows)
+	mux.HandleFunc("/api/list", avatar.ListReport)
+	mux.HandleFunc("/api/detect", avatar.Detect)
+	mux.HandleFunc("/api/twitter/login", avatar.TwitterLogin)
+	mux.HandleFunc("/api/twitter/callback", avatar.TwitterCallback)
+	mux.HandleFunc("/api/fediverse/login", avatar.MastodonLogin)
+	mux.HandleFunc("/api/fediverse/callback", avatar.MastodonCallback)
+	mux.HandleFunc("/healthz", avatar.Healthz)
+	mux.HandleFunc("/readyz", avatar.Readyz)
+	mux.HandleFunc("/metrics", avatar.Metrics)
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		log.Printf("listening on %s", *addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	//drain requests, then flush buffered spans
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Print(err)
+	}
+	if err := avatar.Shutdown(ctx); err != nil {
+		log.Print(err)
+	}
+}
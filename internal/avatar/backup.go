@@ -0,0 +1,125 @@
+package avatar
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+const (
+	actionApply  = "apply"
+	actionRevert = "revert"
+)
+
+// avatarBackup is a user's avatar from before we first changed it, kept in
+// the token store so it is encrypted like the tokens.
+type avatarBackup struct {
+	Platform    string
+	Account     string
+	SourceURL   string
+	ContentType string
+	Image       []byte
+	TakenAt     time.Time
+}
+
+func backupKey(platform, accountID string) string {
+	return "backup:" + platform + ":" + accountID
+}
+
+// originalAvatarURL is the full resolution version of a Twitter avatar.
+func originalAvatarURL(usr *twitter.User) string {
+	return strings.Replace(usr.ProfileImageURLHttps, "_normal", "", 1)
+}
+
+// parseAction reads the action query parameter of the login endpoints.
+func parseAction(r *http.Request) (string, error) {
+	switch a := r.URL.Query().Get("action"); a {
+	case "", actionApply:
+		return actionApply, nil
+	case actionRevert:
+		return actionRevert, nil
+	default:
+		return "", &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_action",
+			Message: `The action must be "apply" or "revert".`,
+		}
+	}
+}
+
+// backupAvatar downloads and stores the avatar at sourceURL, unless there is
+// a backup already: applying a badge twice must not replace the original
+// with the first badged avatar.
+func backupAvatar(ctx context.Context, platform, accountID, account, sourceURL string) error {
+	key := backupKey(platform, accountID)
+	var existing avatarBackup
+	switch err := tokens.get(key, &existing); err {
+	case nil:
+		return nil
+	case errNoToken:
+	default:
+		return err
+	}
+	//Mastodon avatars live wherever the instance says they do
+	client := upstreamClient
+	if platform == "mastodon" {
+		client = fediverseClient
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	img, err := downloadAvatar(ctx, client, sourceURL)
+	if err != nil {
+		return err
+	}
+	return tokens.put(key, avatarBackup{
+		Platform:    platform,
+		Account:     account,
+		SourceURL:   sourceURL,
+		ContentType: http.DetectContentType(img),
+		Image:       img,
+		TakenAt:     time.Now().UTC(),
+	})
+}
+
+// loadBackup returns the stored original avatar of an account.
+func loadBackup(platform, accountID string) (*avatarBackup, error) {
+	b := &avatarBackup{}
+	switch err := tokens.get(backupKey(platform, accountID), b); err {
+	case nil:
+		return b, nil
+	case errNoToken:
+		return nil, &apiError{
+			Status:  http.StatusNotFound,
+			Code:    "no_backup",
+			Message: "There is no original avatar to go back to, we never changed this one.",
+		}
+	default:
+		return nil, err
+	}
+}
+
+// dropBackup forgets the original avatar once it is restored, so the next
+// apply backs up whatever the user has then.
+func dropBackup(platform, accountID string) error {
+	if err := tokens.delete(backupKey(platform, accountID)); err != nil && err != errNoToken {
+		return err
+	}
+	return nil
+}
+
+// imageExt is the file extension for a sniffed image content type.
+func imageExt(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
@@ -0,0 +1,148 @@
+package avatar
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	badgeMastodon = "mastodon"
+	badgeTwitter  = "twitter"
+
+	//badges are drawn at this size, the bundled logo's
+	badgeSize = 200
+	//custom badges larger than this are refused
+	maxBadgeBytes = 1 << 20
+)
+
+var (
+	twitterBadgeOnce sync.Once
+	twitterBadgeImg  image.Image
+	twitterBadgeErr  error
+)
+
+// loadBadge returns the badge named by name, or the image at customURL when
+// it is set.
+func loadBadge(ctx context.Context, name, customURL string) (image.Image, error) {
+	if customURL != "" {
+		return fetchBadge(ctx, customURL)
+	}
+	switch name {
+	case "", badgeMastodon:
+		img, err := decodeBadge()
+		if err != nil {
+			return nil, errMisconfigured(err)
+		}
+		return img, nil
+	case badgeTwitter:
+		twitterBadgeOnce.Do(func() {
+			twitterBadgeImg, twitterBadgeErr = drawTwitterBadge()
+		})
+		if twitterBadgeErr != nil {
+			return nil, errMisconfigured(twitterBadgeErr)
+		}
+		return twitterBadgeImg, nil
+	}
+	return nil, errInvalidBadge(fmt.Errorf("unknown badge %q", name))
+}
+
+// drawTwitterBadge draws the "find me on Twitter" badge: a white t on a
+// Twitter blue disc.
+func drawTwitterBadge() (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, badgeSize, badgeSize))
+	blue := &image.Uniform{color.RGBA{0x1d, 0xa1, 0xf2, 0xff}}
+	draw.DrawMask(img, img.Bounds(), blue, image.Point{}, &circle{image.Pt(badgeSize/2, badgeSize/2), badgeSize / 2}, image.Point{}, draw.Over)
+
+	f, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: badgeSize * 0.7, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	bounds, _ := d.BoundString("t")
+	//center the glyph's ink, not its advance box
+	d.Dot = fixed.Point26_6{
+		X: fixed.I(badgeSize/2) - (bounds.Min.X+bounds.Max.X)/2,
+		Y: fixed.I(badgeSize/2) - (bounds.Min.Y+bounds.Max.Y)/2,
+	}
+	d.DrawString("t")
+	return img, nil
+}
+
+// fetchBadge downloads a custom badge and scales it to the badge size.
+func fetchBadge(ctx context.Context, rawURL string) (image.Image, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errInvalidBadge(err)
+	}
+	if u.Scheme != "https" || u.Port() != "" || !hostPattern.MatchString(u.Hostname()) {
+		return nil, errInvalidBadge(fmt.Errorf("badge url %q is not a plain https url", rawURL))
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errInvalidBadge(err)
+	}
+	resp, err := fediverseClient.Do(req)
+	if err != nil {
+		return nil, upstreamError(err, errAvatarFetch)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errAvatarFetch(fmt.Errorf("badge: unexpected status %s", resp.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBadgeBytes+1))
+	if err != nil {
+		return nil, upstreamError(err, errAvatarFetch)
+	}
+	if len(body) > maxBadgeBytes {
+		return nil, errInvalidBadge(fmt.Errorf("badge is larger than %d bytes", maxBadgeBytes))
+	}
+	img, err := decodeImage(ctx, body)
+	if err != nil {
+		return nil, errInvalidBadge(err)
+	}
+	return fitBadge(img), nil
+}
+
+// fitBadge scales img down so it fits in a badgeSize square.
+func fitBadge(img image.Image) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= badgeSize && b.Dy() <= badgeSize {
+		return img
+	}
+	w, h := badgeSize, b.Dy()*badgeSize/b.Dx()
+	if b.Dy() > b.Dx() {
+		w, h = b.Dx()*badgeSize/b.Dy(), badgeSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Over, nil)
+	return dst
+}
+
+func errInvalidBadge(err error) error {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "invalid_badge",
+		Message: "The badge is unknown or could not be used as an image.",
+		Err:     err,
+	}
+}
@@ -0,0 +1,274 @@
+package avatar
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	//pixels of the badge at least this opaque are the logo, below
+	//minBadgeHole the avatar shows through
+	minBadgeOpaque = 200
+	minBadgeHole   = 50
+	//luminance spread, as a standard deviation, above which the area
+	//around the badge is too busy for any single color to stand out
+	busyLuminance = 0.15
+	//hues closer than this, in degrees, blend in whatever the luminance
+	sameHue = 30
+	//saturation below which a color has no hue to speak of
+	minHueSaturation = 0.25
+)
+
+var (
+	//the light and dark variants of the badge and outline colors
+	badgeLight = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	badgeDark  = color.NRGBA{0x28, 0x2c, 0x37, 0xff}
+
+	minBadgeContrast float64
+)
+
+// badgeStyle is how the badge stands out from the avatar.
+type badgeStyle struct {
+	//Outline strokes the badge in this color when set
+	Outline *color.NRGBA
+	//Shadow casts a soft shadow under the badge
+	Shadow bool
+	//Auto measures the avatar around the badge, and switches to the light
+	//or dark variant or adds an outline when the badge would not stand
+	//out from it by minBadgeContrast
+	Auto bool
+}
+
+// styleBadge applies bs to layer, the badge at its place on avatar.
+func styleBadge(layer ImageLayer, avatar image.Image, bs badgeStyle) ImageLayer {
+	size := layer.Image.Bounds().Dx()
+	if bs.Auto {
+		variant, outline := pickBadgeVariant(layer, avatar)
+		if variant != nil {
+			layer.Image = recolorBadge(layer.Image, *variant)
+		}
+		if outline != nil && bs.Outline == nil {
+			bs.Outline = outline
+		}
+	}
+	if bs.Outline != nil {
+		width := max(size/40, 2)
+		layer.Image = outlineBadge(layer.Image, *bs.Outline, width)
+		layer.XPos, layer.YPos = layer.XPos-width, layer.YPos-width
+	}
+	if bs.Shadow {
+		layer.Shadow = &dropShadow{
+			Color:  color.NRGBA{0, 0, 0, 0x99},
+			Offset: image.Pt(0, max(size/50, 1)),
+			Blur:   math.Max(float64(size)/40, 1),
+		}
+	}
+	return layer
+}
+
+// pickBadgeVariant decides how the badge of layer stands out from the
+// avatar pixels next to it: as it is when the contrast ratio and hues are
+// far enough apart, as the variant of the better contrast when the
+// surroundings are even, and as it is but outlined in that color when they
+// are too busy for one color or the variant still falls short.
+func pickBadgeVariant(layer ImageLayer, avatar image.Image) (variant, outline *color.NRGBA) {
+	logo, around, ok := badgeSurroundings(layer, avatar)
+	if !ok {
+		return nil, nil
+	}
+	bg := around.mean()
+	if contrastRatio(logo.mean().luminance, bg.luminance) >= minBadgeContrast && !sameHues(logo.mean(), bg) {
+		return nil, nil
+	}
+	best, ratio := &badgeLight, contrastRatio(1, bg.luminance)
+	if dark := contrastRatio(relativeLuminance(badgeDark), bg.luminance); dark > ratio {
+		best, ratio = &badgeDark, dark
+	}
+	if around.spread() > busyLuminance || ratio < minBadgeContrast {
+		return nil, best
+	}
+	return best, nil
+}
+
+// badgeSurroundings collects the colors of the opaque badge pixels, and
+// those of the avatar where the badge is see-through: around its edges and
+// in its holes. A badge without see-through pixels is judged against the
+// avatar under it.
+func badgeSurroundings(layer ImageLayer, avatar image.Image) (logo, around colorStats, ok bool) {
+	badge := layer.Image
+	bb, ab := badge.Bounds(), avatar.Bounds()
+	var under colorStats
+	for y := bb.Min.Y; y < bb.Max.Y; y++ {
+		for x := bb.Min.X; x < bb.Max.X; x++ {
+			c := color.NRGBAModel.Convert(badge.At(x, y)).(color.NRGBA)
+			p := image.Pt(ab.Min.X+layer.XPos+x-bb.Min.X, ab.Min.Y+layer.YPos+y-bb.Min.Y)
+			if !p.In(ab) {
+				continue
+			}
+			bg := color.NRGBAModel.Convert(avatar.At(p.X, p.Y)).(color.NRGBA)
+			under.add(bg)
+			switch {
+			case c.A >= minBadgeOpaque:
+				logo.add(c)
+			case c.A < minBadgeHole:
+				around.add(bg)
+			}
+		}
+	}
+	if around.n == 0 {
+		around = under
+	}
+	return logo, around, logo.n > 0 && around.n > 0
+}
+
+// colorStats accumulates the luminance and hue of a set of colors.
+type colorStats struct {
+	n int
+	//sums of the relative luminance and its square
+	l, l2 float64
+	//sum of the hues as vectors, scaled by saturation
+	hx, hy float64
+	s      float64
+}
+
+// colorSummary is the mean of a colorStats.
+type colorSummary struct {
+	luminance  float64
+	hue        float64 //degrees
+	saturation float64
+}
+
+func (cs *colorStats) add(c color.NRGBA) {
+	l := relativeLuminance(c)
+	h, s := hueSaturation(c)
+	sin, cos := math.Sincos(h * math.Pi / 180)
+	cs.n++
+	cs.l += l
+	cs.l2 += l * l
+	cs.hx += s * cos
+	cs.hy += s * sin
+	cs.s += s
+}
+
+func (cs *colorStats) mean() colorSummary {
+	n := float64(cs.n)
+	return colorSummary{
+		luminance:  cs.l / n,
+		hue:        math.Mod(math.Atan2(cs.hy, cs.hx)*180/math.Pi+360, 360),
+		saturation: cs.s / n,
+	}
+}
+
+// spread is the standard deviation of the luminance.
+func (cs *colorStats) spread() float64 {
+	n := float64(cs.n)
+	mean := cs.l / n
+	return math.Sqrt(math.Max(cs.l2/n-mean*mean, 0))
+}
+
+// sameHues reports whether two colors are both clearly colored, and in
+// nearly the same hue, like the blue logo on a purple avatar.
+func sameHues(a, b colorSummary) bool {
+	if a.saturation < minHueSaturation || b.saturation < minHueSaturation {
+		return false
+	}
+	d := math.Abs(a.hue - b.hue)
+	return math.Min(d, 360-d) < sameHue
+}
+
+// relativeLuminance is the WCAG 2 relative luminance of c, from 0 for
+// black to 1 for white.
+func relativeLuminance(c color.NRGBA) float64 {
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// contrastRatio is the WCAG 2 contrast ratio of two relative luminances,
+// from 1 to 21.
+func contrastRatio(a, b float64) float64 {
+	return (math.Max(a, b) + 0.05) / (math.Min(a, b) + 0.05)
+}
+
+// hueSaturation returns the HSV hue, in degrees, and saturation of c.
+func hueSaturation(c color.NRGBA) (hue, saturation float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	d := hi - lo
+	if hi == 0 || d == 0 {
+		return 0, 0
+	}
+	switch hi {
+	case r:
+		hue = math.Mod((g-b)/d, 6)
+	case g:
+		hue = (b-r)/d + 2
+	default:
+		hue = (r-g)/d + 4
+	}
+	return math.Mod(hue*60+360, 360), d / hi
+}
+
+// recolorBadge returns badge in a single color, keeping its alpha.
+func recolorBadge(badge image.Image, c color.NRGBA) *image.RGBA {
+	b := badge.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.DrawMask(img, img.Bounds(), &image.Uniform{c}, image.Point{}, badge, b.Min, draw.Src)
+	return img
+}
+
+// outlineBadge returns badge with a stroke of width pixels around its
+// shape, on an image larger by width on every side. The stroke edge is
+// anti-aliased.
+func outlineBadge(badge image.Image, c color.NRGBA, width int) *image.RGBA {
+	b := badge.Bounds()
+	w, h := b.Dx()+2*width, b.Dy()+2*width
+	alpha := make([]float64, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := badge.At(x, y).RGBA()
+			alpha[(y-b.Min.Y+width)*w+x-b.Min.X+width] = float64(a) / 0xffff
+		}
+	}
+
+	//dilate the alpha by a disk of radius width, softened at its rim
+	type tap struct {
+		dx, dy int
+		weight float64
+	}
+	var disk []tap
+	for dy := -width; dy <= width; dy++ {
+		for dx := -width; dx <= width; dx++ {
+			d := math.Hypot(float64(dx), float64(dy))
+			if weight := math.Min(float64(width)+0.5-d, 1); weight > 0 {
+				disk = append(disk, tap{dx, dy, weight})
+			}
+		}
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var a float64
+			for _, t := range disk {
+				xx, yy := x+t.dx, y+t.dy
+				if xx < 0 || yy < 0 || xx >= w || yy >= h {
+					continue
+				}
+				a = math.Max(a, alpha[yy*w+xx]*t.weight)
+			}
+			mask.Pix[y*w+x] = uint8(math.Round(a * 255))
+		}
+	}
+
+	img := image.NewRGBA(mask.Bounds())
+	draw.DrawMask(img, img.Bounds(), &image.Uniform{c}, image.Point{}, mask, image.Point{}, draw.Src)
+	draw.Draw(img, b.Sub(b.Min).Add(image.Pt(width, width)), badge, b.Min, draw.Over)
+	return img
+}
@@ -0,0 +1,113 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	twitterBreaker  *breaker
+	avatarBreaker   *breaker
+	mastodonBreaker *breaker
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker around an upstream. After threshold
+// consecutive failures it opens and fails calls immediately; once openFor has
+// passed it half-opens and lets a single probe through, which closes it again
+// on success.
+type breaker struct {
+	name      string
+	threshold int
+	openFor   time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(name string, threshold int, openFor time.Duration) *breaker {
+	return &breaker{name: name, threshold: threshold, openFor: openFor}
+}
+
+// allow reports whether a call may go through. Every allowed call must be
+// followed by a call to record.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openFor {
+			return b.openError()
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return b.openError()
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record feeds the outcome of an allowed call back into the breaker. Only
+// upstream failures count; a missing user is not an outage.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		//we gave up on the call, it says nothing about the upstream
+		return
+	}
+	if !isUpstreamFailure(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *breaker) openError() error {
+	return &apiError{
+		Status:     http.StatusServiceUnavailable,
+		Code:       "upstream_unavailable",
+		Message:    fmt.Sprintf("%s is unavailable, try again later.", b.name),
+		RetryAfter: b.openFor - time.Since(b.openedAt),
+	}
+}
+
+// isUpstreamFailure reports whether err means the upstream itself is failing,
+// as opposed to a request it answered with a definite no. Only the errors the
+// upstream calls are mapped onto count; anything else, such as a bug in our
+// own rendering, is not an outage.
+func isUpstreamFailure(err error) bool {
+	var e *apiError
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code {
+	case "twitter_unavailable", "avatar_fetch_failed", "mastodon_unavailable", "upstream_unavailable", "upstream_timeout":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package avatar
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBreakerStateChanges(t *testing.T) {
+	upstreamDown := &apiError{Code: "twitter_unavailable"}
+	notFound := &apiError{Code: "user_not_found"}
+	tests := []struct {
+		name      string
+		steps     []string //calls ending in "fail", "ok", "miss" or "cancel", "probe" for one still running, or "elapse" for openFor passing
+		wantState breakerState
+		wantCode  string //of the next allow, "" if it goes through
+	}{
+		{name: "closed", steps: nil, wantState: breakerClosed},
+		{name: "below threshold", steps: []string{"fail", "fail"}, wantState: breakerClosed},
+		{name: "success resets the count", steps: []string{"fail", "fail", "ok", "fail", "fail"}, wantState: breakerClosed},
+		{name: "opens at threshold", steps: []string{"fail", "fail", "fail"}, wantState: breakerOpen, wantCode: "upstream_unavailable"},
+		{name: "definite answers are not failures", steps: []string{"miss", "miss", "miss"}, wantState: breakerClosed},
+		{name: "cancelled calls are not counted", steps: []string{"fail", "fail", "cancel", "fail"}, wantState: breakerOpen, wantCode: "upstream_unavailable"},
+		{name: "half-opens after openFor", steps: []string{"fail", "fail", "fail", "elapse"}, wantState: breakerOpen},
+		{name: "one probe at a time", steps: []string{"fail", "fail", "fail", "elapse", "probe"}, wantState: breakerHalfOpen, wantCode: "upstream_unavailable"},
+		{name: "probe success closes", steps: []string{"fail", "fail", "fail", "elapse", "ok"}, wantState: breakerClosed},
+		{name: "probe failure reopens", steps: []string{"fail", "fail", "fail", "elapse", "fail"}, wantState: breakerOpen, wantCode: "upstream_unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker("Twitter", 3, time.Minute)
+			for i, step := range tt.steps {
+				if step == "elapse" {
+					b.openedAt = b.openedAt.Add(-b.openFor)
+					continue
+				}
+				if err := b.allow(); err != nil {
+					t.Fatalf("step %d (%s): allow() = %v", i, step, err)
+				}
+				switch step {
+				case "fail":
+					b.record(upstreamDown)
+				case "ok":
+					b.record(nil)
+				case "miss":
+					b.record(notFound)
+				case "cancel":
+					b.record(context.Canceled)
+				}
+			}
+			if b.state != tt.wantState {
+				t.Errorf("state = %d, want %d", b.state, tt.wantState)
+			}
+			if err := b.allow(); err != nil && errorClass(err) != tt.wantCode || err == nil && tt.wantCode != "" {
+				t.Errorf("allow() = %v, want code %q", err, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package avatar
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+var lastRenders *renderCache
+
+// renderCache keeps the most recent good render per cache key. Entries are
+// served directly while fresh and kept around afterwards, up to staleFor, to
+// be served when the upstreams are failing. The cache is bounded by the total
+// size of the stored PNGs rather than their number, since a share card is
+// many times the size of a plain avatar.
+type renderCache struct {
+	maxBytes int
+	freshFor time.Duration
+	staleFor time.Duration
+
+	mu      sync.Mutex
+	bytes   int
+	order   *list.List //front is most recently used
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key        string
+	png        []byte
+	renderedAt time.Time
+}
+
+func newRenderCache(maxBytes int, freshFor, staleFor time.Duration) *renderCache {
+	return &renderCache{
+		maxBytes: maxBytes,
+		freshFor: freshFor,
+		staleFor: staleFor,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry for key if it is still within staleFor.
+func (c *renderCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Since(entry.renderedAt) > c.staleFor {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry, true
+}
+
+// put stores a good render, evicting the least recently used entries until
+// the cache fits in maxBytes. A render larger than the whole cache is not
+// stored.
+func (c *renderCache) put(key string, png []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if len(png) > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, png: png, renderedAt: time.Now()})
+	c.bytes += len(png)
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *renderCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.order.Remove(el)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.png)
+}
+
+// fresh reports whether the entry can be served without re-rendering.
+func (c *renderCache) fresh(entry *cacheEntry) bool {
+	return time.Since(entry.renderedAt) <= c.freshFor
+}
@@ -0,0 +1,208 @@
+package avatar
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ellipsis = "…"
+	//caption text is fitted between these fractions of the bar height
+	captionMaxSize = 0.55
+	captionMinSize = 0.3
+	//longest caption accepted, in runes
+	maxCaptionLength = 100
+)
+
+// captionFonts are tried in order for every character: the configured or
+// embedded caption font, the configured fallbacks, and Go Regular last.
+var captionFonts []*opentype.Font
+
+// loadFonts parses the font at path, Go Bold when empty, followed by the
+// fallbacks and Go Regular. Font collections (.ttc) contribute their first
+// font.
+func loadFonts(path string, fallbacks []string) ([]*opentype.Font, error) {
+	primary, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if primary, err = loadFont(path); err != nil {
+			return nil, err
+		}
+	}
+	fonts := []*opentype.Font{primary}
+	for _, path := range fallbacks {
+		f, err := loadFont(path)
+		if err != nil {
+			return nil, err
+		}
+		fonts = append(fonts, f)
+	}
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return append(fonts, regular), nil
+}
+
+func loadFont(path string) (*opentype.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: reading font: %w", err)
+	}
+	if f, err := opentype.Parse(data); err == nil {
+		return f, nil
+	}
+	c, err := opentype.ParseCollection(data)
+	if err != nil || c.NumFonts() == 0 {
+		return nil, fmt.Errorf("config: %s is not a TrueType or OpenType font", path)
+	}
+	return c.Font(0)
+}
+
+// drawCaption draws text centered on a translucent dark bar along the
+// bottom of img. The text is shrunk to fit the width, and cut short with an
+// ellipsis when even the smallest size is too wide.
+func drawCaption(img *image.RGBA, text string) error {
+	b := img.Bounds()
+	barHeight := captionHeight(b)
+	padding := fixed.I(barHeight / 3)
+	room := fixed.I(b.Dx()) - 2*padding
+
+	face, _, err := fitFace(captionFonts, text, float64(barHeight)*captionMaxSize, float64(barHeight)*captionMinSize,
+		func(font.Face) fixed.Int26_6 { return room })
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+	text = truncate(face, text, room)
+
+	bar := image.Rect(b.Min.X, b.Max.Y-barHeight, b.Max.X, b.Max.Y)
+	draw.Draw(img, bar, &image.Uniform{color.NRGBA{0, 0, 0, 0x99}}, image.Point{}, draw.Over)
+
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	m := face.Metrics()
+	//center the line of text on the bar
+	d.Dot = fixed.Point26_6{
+		X: fixed.I(bar.Min.X+bar.Dx()/2) - d.MeasureString(text)/2,
+		Y: fixed.I(bar.Min.Y+bar.Dy()/2) + (m.Ascent-m.Descent)/2,
+	}
+	d.DrawString(text)
+	return nil
+}
+
+// captionHeight is the height of the caption bar on an avatar of bounds b.
+func captionHeight(b image.Rectangle) int {
+	return b.Dy() / 8
+}
+
+// fitFace returns a face for text of the largest size from maxSize down
+// to minSize at which text fits in the room it has, or of the smallest
+// size, along with that room. room is asked for every size, as it may
+// depend on the metrics of the face.
+func fitFace(fonts []*opentype.Font, text string, maxSize, minSize float64, room func(font.Face) fixed.Int26_6) (*fallbackFace, fixed.Int26_6, error) {
+	for size := maxSize; ; size *= 0.9 {
+		f, err := newFallbackFace(fonts, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		r := room(f)
+		if font.MeasureString(f, text) <= r || size*0.9 < minSize {
+			return f, r, nil
+		}
+		f.Close()
+	}
+}
+
+// truncate shortens text to fit in room, ending it with an ellipsis.
+func truncate(face font.Face, text string, room fixed.Int26_6) string {
+	if font.MeasureString(face, text) <= room {
+		return text
+	}
+	runes := []rune(strings.TrimSpace(text))
+	for n := len(runes) - 1; n > 0; n-- {
+		s := strings.TrimSpace(string(runes[:n])) + ellipsis
+		if font.MeasureString(face, s) <= room {
+			return s
+		}
+	}
+	return ellipsis
+}
+
+// fallbackFace draws every rune with the first of its faces that has a
+// glyph for it, so scripts the caption font lacks still show up.
+type fallbackFace struct {
+	faces []font.Face
+}
+
+func newFallbackFace(fonts []*opentype.Font, size float64) (*fallbackFace, error) {
+	ff := &fallbackFace{}
+	for _, f := range fonts {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			ff.Close()
+			return nil, err
+		}
+		ff.faces = append(ff.faces, face)
+	}
+	if len(ff.faces) == 0 {
+		return nil, errMisconfigured(fmt.Errorf("no fonts loaded"))
+	}
+	return ff, nil
+}
+
+// faceFor returns the first face with a glyph for r, or the primary face,
+// which then draws its missing glyph box.
+func (f *fallbackFace) faceFor(r rune) font.Face {
+	for _, face := range f.faces {
+		if _, ok := face.GlyphAdvance(r); ok {
+			return face
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faceFor(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphAdvance(r)
+}
+
+// Kern only applies within a face, pairs across fonts have none.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.faceFor(r0)
+	if face != f.faceFor(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+// Metrics are the primary face's, so the line sits the same whatever the
+// script.
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
@@ -0,0 +1,83 @@
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// listChart draws the counts of report as a bar chart.
+func listChart(report *listReport) ([]byte, error) {
+	const (
+		width, height = 640, 360
+		margin        = 24
+		labelWidth    = 170
+		barHeight     = 44
+		barGap        = 18
+	)
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, errMisconfigured(err)
+	}
+	title, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 22, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer title.Close()
+	label, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 16, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer label.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	text := func(face font.Face, x, y int, s string) {
+		d := &font.Drawer{Dst: img, Src: &image.Uniform{color.RGBA{0x29, 0x2f, 0x33, 0xff}}, Face: face, Dot: fixed.P(x, y)}
+		d.DrawString(s)
+	}
+
+	name := report.Name
+	if name == "" {
+		name = "List " + report.ListID
+	}
+	text(title, margin, margin+20, fmt.Sprintf("%s: %d members checked", name, report.Checked))
+
+	bars := []struct {
+		label string
+		count int
+		color color.RGBA
+	}{
+		{"Handle and badge", report.Counts.HandleAndBadge, color.RGBA{0x56, 0x3a, 0xcc, 0xff}},
+		{"Handle only", report.Counts.Handle, color.RGBA{0x8c, 0x8d, 0xff, 0xff}},
+		{"Badge only", report.Counts.Badge, color.RGBA{0x2b, 0x90, 0xd9, 0xff}},
+		{"Neither", report.Counts.Neither, color.RGBA{0xcf, 0xd9, 0xde, 0xff}},
+	}
+	maxBar := width - 2*margin - labelWidth - 60
+	y := margin + 56
+	for _, b := range bars {
+		text(label, margin, y+barHeight/2+6, b.label)
+		w := 0
+		if report.Checked > 0 {
+			w = b.count * maxBar / report.Checked
+		}
+		x := margin + labelWidth
+		draw.Draw(img, image.Rect(x, y, x+max(w, 2), y+barHeight), &image.Uniform{b.color}, image.Point{}, draw.Src)
+		text(label, x+max(w, 2)+8, y+barHeight/2+6, fmt.Sprint(b.count))
+		y += barHeight + barGap
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
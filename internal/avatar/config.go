@@ -0,0 +1,246 @@
+package avatar
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/koding/multiconfig"
+)
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	TokenUrl     string `default:"https://api.twitter.com/oauth2/token"`
+
+	//additional "id:secret" client credential pairs, used alongside ClientID
+	Credentials        []string
+	CredentialStrategy string        `default:"round-robin"`
+	CredentialCooldown time.Duration `default:"1m"`
+
+	//bounds on concurrent decode/encode work
+	MaxConcurrentRenders int           `default:"8"`
+	RenderQueueTimeout   time.Duration `default:"2s"`
+
+	//per-stage deadlines; RenderTimeout covers decode, composite and encode
+	LookupTimeout   time.Duration `default:"5s"`
+	DownloadTimeout time.Duration `default:"10s"`
+	RenderTimeout   time.Duration `default:"10s"`
+
+	//last good renders, served while fresh and as a fallback when upstreams fail
+	RenderCacheBytes int           `default:"67108864"`
+	RenderCacheTTL   time.Duration `default:"5m"`
+	StaleTTL         time.Duration `default:"168h"`
+
+	//circuit breakers around the Twitter lookup and the avatar fetch
+	BreakerThreshold int           `default:"5"`
+	BreakerOpenFor   time.Duration `default:"30s"`
+
+	//client rate limits in requests per second, and API keys as "key:dailyQuota"
+	//entries (quota 0 is unlimited) from env and/or a file with one per line
+	IPRateLimit   float64 `default:"1"`
+	IPRateBurst   int     `default:"10"`
+	KeyRateLimit  float64 `default:"10"`
+	KeyRateBurst  int     `default:"50"`
+	APIKeys       []string
+	APIKeysFile   string
+	RequireAPIKey bool
+	TrustProxy    bool
+
+	//HMAC secret for signed links; RequireSignature rejects unsigned requests
+	SigningSecret    string
+	RequireSignature bool
+
+	//usernames that must not be rendered, one per line, reloaded when changed;
+	//OptOutSecret enables the self-service opt-out flow
+	OptOutFile   string
+	OptOutReload time.Duration `default:"30s"`
+	OptOutSecret string
+
+	//applying avatars to profiles: PublicURL is where the OAuth callbacks are
+	//reached, the Twitter bases can point at a local stand-in, and the flows
+	//are only enabled with a TokenEncryptionKey (32 bytes, base64) and a
+	//durable TokenStoreDir: tokens and avatar backups must outlive the process
+	PublicURL          string `default:"https://mastodon-in-twitter-avatar.vercel.app"`
+	TwitterOAuthBase   string `default:"https://api.twitter.com"`
+	TwitterAPIBase     string `default:"https://api.twitter.com"`
+	TokenEncryptionKey string
+	TokenStoreDir      string
+
+	//caption font (TTF/OTF, default Go Bold) and fonts tried for characters it lacks,
+	//such as a Noto font for CJK
+	CaptionFont          string
+	CaptionFallbackFonts []string
+	//font of the text ring, the fallbacks are shared with captions
+	RingFont string
+
+	//contrast ratio (WCAG 2, 1 to 21) the badge must reach with badge_contrast=auto
+	BadgeMinContrast float64 `default:"3"`
+
+	//find-my-follows jobs running at once, how many may wait for a slot and
+	//for how long, and how long their results are kept
+	MaxFollowJobs       int           `default:"2"`
+	MaxQueuedFollowJobs int           `default:"20"`
+	FollowQueueTimeout  time.Duration `default:"30m"`
+	FollowJobTTL        time.Duration `default:"24h"`
+
+	//list migration reports: members checked per list, and how long a report is reused
+	MaxListMembers int           `default:"1000"`
+	ListReportTTL  time.Duration `default:"15m"`
+
+	//debug, info, warn or error; HashUsernames logs an HMAC keyed with
+	//UsernameHashKey instead of the name
+	LogLevel        string `default:"info"`
+	HashUsernames   bool
+	UsernameHashKey string
+
+	//tracing: none, stdout or otlp (OTLP over HTTP to OTLPEndpoint)
+	TraceExporter    string `default:"none"`
+	OTLPEndpoint     string `default:"localhost:4318"`
+	OTLPInsecure     bool
+	TraceSampleRatio float64 `default:"1"`
+	ServiceName      string  `default:"mastodon-in-twitter-avatar"`
+}
+
+// loadConfig reads the config from its defaults, the optional file named by
+// CONFIG_FILE (.toml, .json, .yml or .yaml) and then CONFIG_* env vars, and
+// validates the result.
+func loadConfig() (*Config, error) {
+	loaders := []multiconfig.Loader{&multiconfig.TagLoader{}}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		switch {
+		case strings.HasSuffix(path, ".toml"):
+			loaders = append(loaders, &multiconfig.TOMLLoader{Path: path})
+		case strings.HasSuffix(path, ".json"):
+			loaders = append(loaders, &multiconfig.JSONLoader{Path: path})
+		case strings.HasSuffix(path, ".yml"), strings.HasSuffix(path, ".yaml"):
+			loaders = append(loaders, &multiconfig.YAMLLoader{Path: path})
+		default:
+			return nil, fmt.Errorf("config: unsupported config file %q, use .toml, .json or .yaml", path)
+		}
+	}
+	loaders = append(loaders, &multiconfig.EnvironmentLoader{})
+
+	conf := &Config{}
+	if err := multiconfig.MultiLoader(loaders...).Load(conf); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// validate reports every problem with the config at once.
+func (c *Config) validate() error {
+	var errs []error
+	if c.ClientID == "" {
+		errs = append(errs, errors.New("config: ClientID is required (CONFIG_CLIENTID)"))
+	}
+	if c.ClientSecret == "" {
+		errs = append(errs, errors.New("config: ClientSecret is required (CONFIG_CLIENTSECRET)"))
+	}
+	if u, err := url.Parse(c.TokenUrl); err != nil || !u.IsAbs() {
+		errs = append(errs, fmt.Errorf("config: TokenUrl %q is not an absolute URL", c.TokenUrl))
+	}
+	for i, pair := range c.Credentials {
+		if id, secret, ok := strings.Cut(pair, ":"); !ok || id == "" || secret == "" {
+			errs = append(errs, fmt.Errorf("config: Credentials[%d] must be of the form id:secret", i))
+		}
+	}
+	if c.CredentialStrategy != strategyRoundRobin && c.CredentialStrategy != strategyLeastUsed {
+		errs = append(errs, fmt.Errorf("config: CredentialStrategy must be %q or %q, got %q",
+			strategyRoundRobin, strategyLeastUsed, c.CredentialStrategy))
+	}
+	if c.CredentialCooldown <= 0 {
+		errs = append(errs, errors.New("config: CredentialCooldown must be positive"))
+	}
+	if c.MaxConcurrentRenders < 1 {
+		errs = append(errs, errors.New("config: MaxConcurrentRenders must be at least 1"))
+	}
+	if c.RenderQueueTimeout <= 0 {
+		errs = append(errs, errors.New("config: RenderQueueTimeout must be positive"))
+	}
+	if c.LookupTimeout <= 0 || c.DownloadTimeout <= 0 || c.RenderTimeout <= 0 {
+		errs = append(errs, errors.New("config: LookupTimeout, DownloadTimeout and RenderTimeout must be positive"))
+	}
+	if c.RenderCacheBytes < 1 {
+		errs = append(errs, errors.New("config: RenderCacheBytes must be at least 1"))
+	}
+	if c.StaleTTL < c.RenderCacheTTL {
+		errs = append(errs, errors.New("config: StaleTTL must not be shorter than RenderCacheTTL"))
+	}
+	if c.BreakerThreshold < 1 {
+		errs = append(errs, errors.New("config: BreakerThreshold must be at least 1"))
+	}
+	if c.BreakerOpenFor <= 0 {
+		errs = append(errs, errors.New("config: BreakerOpenFor must be positive"))
+	}
+	if c.IPRateLimit <= 0 || c.KeyRateLimit <= 0 || c.IPRateBurst < 1 || c.KeyRateBurst < 1 {
+		errs = append(errs, errors.New("config: rate limits and bursts must be positive"))
+	}
+	if c.RequireAPIKey && len(c.APIKeys) == 0 && c.APIKeysFile == "" {
+		errs = append(errs, errors.New("config: RequireAPIKey is set but no APIKeys or APIKeysFile are configured"))
+	}
+	if c.HashUsernames && c.UsernameHashKey == "" {
+		errs = append(errs, errors.New("config: HashUsernames is set but UsernameHashKey is empty"))
+	}
+	if c.RequireSignature && c.SigningSecret == "" {
+		errs = append(errs, errors.New("config: RequireSignature is set but SigningSecret is empty"))
+	}
+	for name, v := range map[string]string{"PublicURL": c.PublicURL, "TwitterOAuthBase": c.TwitterOAuthBase, "TwitterAPIBase": c.TwitterAPIBase} {
+		if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+			errs = append(errs, fmt.Errorf("config: %s %q is not an absolute URL", name, v))
+		}
+	}
+	if c.TokenEncryptionKey != "" {
+		if err := checkDurableDir(c.TokenStoreDir); err != nil {
+			errs = append(errs, fmt.Errorf("config: TokenStoreDir: %w", err))
+		}
+	}
+	if c.MaxFollowJobs < 1 || c.FollowJobTTL <= 0 {
+		errs = append(errs, errors.New("config: MaxFollowJobs must be at least 1 and FollowJobTTL positive"))
+	}
+	if c.MaxQueuedFollowJobs < 1 || c.FollowQueueTimeout <= 0 {
+		errs = append(errs, errors.New("config: MaxQueuedFollowJobs must be at least 1 and FollowQueueTimeout positive"))
+	}
+	if c.MaxListMembers < 1 || c.ListReportTTL <= 0 {
+		errs = append(errs, errors.New("config: MaxListMembers must be at least 1 and ListReportTTL positive"))
+	}
+	if c.BadgeMinContrast < 1 || c.BadgeMinContrast > 21 {
+		errs = append(errs, errors.New("config: BadgeMinContrast must be between 1 and 21"))
+	}
+	switch c.TraceExporter {
+	case exporterNone, exporterStdout, exporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("config: TraceExporter must be %q, %q or %q, got %q",
+			exporterNone, exporterStdout, exporterOTLP, c.TraceExporter))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, errors.New("config: TraceSampleRatio must be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// checkDurableDir fails unless dir is set and outside the temporary
+// directory, which is wiped on restarts and is per instance on serverless
+// platforms. Losing the token store loses the avatar backups with it.
+func checkDurableDir(dir string) error {
+	if dir == "" {
+		return errors.New("must be set when TokenEncryptionKey is")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for _, tmp := range []string{os.TempDir(), "/tmp", "/var/tmp"} {
+		if rel, err := filepath.Rel(tmp, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%q is a temporary directory, use durable storage", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package avatar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDurableDir(t *testing.T) {
+	tests := []struct {
+		dir     string
+		wantErr bool
+	}{
+		{dir: "", wantErr: true},
+		{dir: "/tmp", wantErr: true},
+		{dir: "/tmp/mastodon-in-twitter-avatar/tokens", wantErr: true},
+		{dir: "/var/tmp/tokens", wantErr: true},
+		{dir: filepath.Join(os.TempDir(), "tokens"), wantErr: true},
+		{dir: "/var/lib/mastodon-in-twitter-avatar/tokens"},
+		{dir: "/tmpfoo/tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if err := checkDurableDir(tt.dir); (err != nil) != tt.wantErr {
+				t.Errorf("checkDurableDir(%q) = %v, want error %v", tt.dir, err, tt.wantErr)
+			}
+		})
+	}
+}
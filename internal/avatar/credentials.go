@@ -0,0 +1,304 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Credential selection strategies for Config.CredentialStrategy.
+const (
+	strategyRoundRobin = "round-robin"
+	strategyLeastUsed  = "least-used"
+)
+
+// Twitter API endpoints we call, as passed to credentialPool.do. Twitter
+// rate limits each endpoint separately.
+const (
+	endpointUsersShow   = "/1.1/users/show.json"
+	endpointFriendsList = "/1.1/friends/list.json"
+	endpointListsShow   = "/1.1/lists/show.json"
+	endpointListMembers = "/1.1/lists/members.json"
+	endpointUserByID    = "/2/users/:id"
+)
+
+var twitterPool *credentialPool
+
+// credential is one app-only client together with what we know about its
+// rate limit windows and health.
+type credential struct {
+	index      string //position in the pool, used as metrics label
+	clientID   string
+	tokens     oauth2.TokenSource
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	limits    map[string]*rateWindow //by endpoint
+	failures  int
+	downUntil time.Time
+}
+
+// rateWindow is what the last response told us about an endpoint's rate
+// limit window, and how often we called the endpoint.
+type rateWindow struct {
+	remaining int
+	reset     time.Time
+	uses      int64
+}
+
+// tokenTimeout bounds a single OAuth2 token fetch.
+const tokenTimeout = 5 * time.Second
+
+// credentialPool hands out credentials that are neither exhausted nor
+// unhealthy, so one spent key doesn't take the whole service down.
+type credentialPool struct {
+	creds    []*credential
+	strategy string
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	next int
+}
+
+// newCredentialPool builds a client per "id:secret" pair.
+func newCredentialPool(pairs []string, tokenURL string, strategy string, cooldown time.Duration) *credentialPool {
+	p := &credentialPool{strategy: strategy, cooldown: cooldown}
+	for _, pair := range pairs {
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			continue
+		}
+		config := &clientcredentials.Config{
+			ClientID:     id,
+			ClientSecret: secret,
+			TokenURL:     tokenURL,
+		}
+		//token fetches and API calls both go through the traced upstream
+		//client; token fetches also get a deadline of their own since
+		//checkToken and the ReuseTokenSource have no request context
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, upstreamClient)
+		tokenClient := *upstreamClient
+		tokenClient.Timeout = tokenTimeout
+		tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient, &tokenClient)
+		tokens := oauth2.ReuseTokenSource(nil, config.TokenSource(tokenCtx))
+		p.creds = append(p.creds, &credential{
+			index:      strconv.Itoa(len(p.creds)),
+			clientID:   id,
+			tokens:     tokens,
+			httpClient: oauth2.NewClient(ctx, tokens),
+			limits:     map[string]*rateWindow{},
+		})
+	}
+	return p
+}
+
+// available reports whether c may be used for endpoint at now, and otherwise
+// when it will be usable again and whether that is because it is rate limited.
+func (c *credential) available(endpoint string, now time.Time) (ok bool, until time.Time, limited bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Before(c.downUntil) {
+		return false, c.downUntil, false
+	}
+	if w := c.limits[endpoint]; w != nil && w.remaining == 0 && now.Before(w.reset) {
+		return false, w.reset, true
+	}
+	return true, time.Time{}, false
+}
+
+// remaining is the number of calls left on endpoint in the current window,
+// -1 if no response has told us yet.
+func (c *credential) remaining(endpoint string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.limits[endpoint]
+	if w == nil || !w.reset.IsZero() && !now.Before(w.reset) {
+		return -1
+	}
+	return w.remaining
+}
+
+// uses is the number of calls made with c to endpoint.
+func (c *credential) uses(endpoint string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w := c.limits[endpoint]; w != nil {
+		return w.uses
+	}
+	return 0
+}
+
+// observe records the rate limit headers and outcome of a call made with c to
+// endpoint.
+func (c *credential) observe(endpoint string, resp *http.Response, err error, cooldown time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.limits[endpoint]
+	if w == nil {
+		w = &rateWindow{remaining: -1}
+		c.limits[endpoint] = w
+	}
+	w.uses++
+	if resp != nil {
+		if v, perr := strconv.Atoi(resp.Header.Get("x-rate-limit-remaining")); perr == nil {
+			w.remaining = v
+			rateLimitRemaining.WithLabelValues(c.index, endpoint).Set(float64(v))
+		}
+		if v, perr := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64); perr == nil {
+			w.reset = time.Unix(v, 0)
+		}
+	}
+	var apiErr twitter.APIError
+	hasCode := errors.As(err, &apiErr) && !apiErr.Empty()
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusTooManyRequests,
+		hasCode && apiErr.Errors[0].Code == twitterCodeRateLimited:
+		w.remaining = 0
+		if w.reset.Before(time.Now()) {
+			w.reset = time.Now().Add(cooldown)
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		//our own deadline, says nothing about the credential
+	case resp != nil && resp.StatusCode == http.StatusUnauthorized, resp == nil && err != nil:
+		//bad credentials or no response at all, take it out for a while
+		c.failures++
+		c.downUntil = time.Now().Add(cooldown * time.Duration(c.failures))
+	case err == nil:
+		c.failures = 0
+	}
+}
+
+// pick returns the next credential usable for endpoint according to the
+// pool's strategy. When every credential is exhausted or unhealthy it returns
+// a rate_limited or twitter_unavailable apiError that says when to come back.
+func (p *credentialPool) pick(endpoint string) (*credential, error) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *credential
+	var earliest time.Time
+	anyLimited := false
+	for i := range p.creds {
+		idx := (p.next + i) % len(p.creds)
+		c := p.creds[idx]
+		ok, until, limited := c.available(endpoint, now)
+		if !ok {
+			if earliest.IsZero() || until.Before(earliest) {
+				earliest = until
+			}
+			anyLimited = anyLimited || limited
+			continue
+		}
+		if p.strategy != strategyLeastUsed {
+			p.next = idx + 1
+			return c, nil
+		}
+		if best == nil || lessUsed(endpoint, now, c, best) {
+			best = c
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if len(p.creds) == 0 {
+		return nil, errMisconfigured(errors.New("no twitter credentials configured"))
+	}
+	if !anyLimited {
+		return nil, &apiError{
+			Status:     http.StatusServiceUnavailable,
+			Code:       "twitter_unavailable",
+			Message:    "Twitter could not be reached.",
+			RetryAfter: earliest.Sub(now),
+		}
+	}
+	return nil, &apiError{
+		Status:     http.StatusTooManyRequests,
+		Code:       "rate_limited",
+		Message:    "Twitter is rate limiting us, try again later.",
+		RetryAfter: earliest.Sub(now),
+	}
+}
+
+// lessUsed prefers the credential with the most remaining calls on endpoint,
+// then the one used least often on it.
+func lessUsed(endpoint string, now time.Time, a, b *credential) bool {
+	ar, br := a.remaining(endpoint, now), b.remaining(endpoint, now)
+	if ar < 0 {
+		ar = int(^uint(0) >> 1)
+	}
+	if br < 0 {
+		br = int(^uint(0) >> 1)
+	}
+	if ar != br {
+		return ar > br
+	}
+	return a.uses(endpoint) < b.uses(endpoint)
+}
+
+// do runs call, which calls endpoint, with a pooled client whose requests are
+// bound to ctx. A call that gets rate limited is retried on the next usable
+// credential.
+func (p *credentialPool) do(ctx context.Context, endpoint string, call func(*twitter.Client) (*http.Response, error)) (*http.Response, error) {
+	return p.doHTTP(ctx, endpoint, func(client *http.Client) (*http.Response, error) {
+		return call(twitter.NewClient(client))
+	})
+}
+
+// doHTTP is do for the API endpoints go-twitter doesn't cover. call must
+// return an error for unsuccessful responses.
+func (p *credentialPool) doHTTP(ctx context.Context, endpoint string, call func(*http.Client) (*http.Response, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		c, err := p.pick(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := call(c.clientFor(ctx))
+		c.observe(endpoint, resp, err, p.cooldown)
+		if err == nil || attempt >= len(p.creds)-1 {
+			return resp, err
+		}
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+	}
+}
+
+// checkToken succeeds if an OAuth2 token can be obtained for any credential.
+func (p *credentialPool) checkToken() error {
+	var errs []error
+	for _, c := range p.creds {
+		_, err := c.tokens.Token()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return errors.New("no twitter credentials configured")
+	}
+	return errors.Join(errs...)
+}
+
+// clientFor returns the credential's HTTP client with every request bound to
+// ctx. go-twitter has no context support of its own.
+func (c *credential) clientFor(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &contextTransport{ctx: ctx, base: c.httpClient.Transport}}
+}
+
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
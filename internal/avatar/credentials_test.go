@@ -0,0 +1,87 @@
+package avatar
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// rateLimited is a response that spends the last call on an endpoint until
+// reset.
+func rateLimited(reset time.Time) *http.Response {
+	h := http.Header{}
+	h.Set("x-rate-limit-remaining", "0")
+	h.Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+	return &http.Response{StatusCode: http.StatusOK, Header: h}
+}
+
+func TestCredentialPoolPerEndpointLimits(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		strategy  string
+		exhausted map[string][]int //endpoint to the credentials spent on it
+		used      map[string][]int //endpoint to credentials, one call per entry
+		endpoint  string
+		want      string //index of the picked credential, "" for an error
+		wantCode  string
+	}{
+		{name: "fresh pool", endpoint: endpointUsersShow, want: "0"},
+		{
+			name:      "other endpoint spent",
+			exhausted: map[string][]int{endpointFriendsList: {0, 1}, endpointListMembers: {0, 1}, endpointUserByID: {0, 1}},
+			endpoint:  endpointUsersShow,
+			want:      "0",
+		},
+		{
+			name:      "same endpoint spent on one credential",
+			exhausted: map[string][]int{endpointUsersShow: {0}},
+			endpoint:  endpointUsersShow,
+			want:      "1",
+		},
+		{
+			name:      "same endpoint spent on every credential",
+			exhausted: map[string][]int{endpointUsersShow: {0, 1}},
+			endpoint:  endpointUsersShow,
+			wantCode:  "rate_limited",
+		},
+		{
+			name:      "least used skips spent credential",
+			strategy:  strategyLeastUsed,
+			exhausted: map[string][]int{endpointUsersShow: {0}},
+			endpoint:  endpointUsersShow,
+			want:      "1",
+		},
+		{
+			//credential 0 made more calls in total, but fewer on users/show
+			name:     "least used ignores other endpoints",
+			strategy: strategyLeastUsed,
+			used:     map[string][]int{endpointFriendsList: {0, 0, 0}, endpointUsersShow: {1}},
+			endpoint: endpointUsersShow,
+			want:     "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newCredentialPool([]string{"a:x", "b:y"}, "http://localhost/token", tt.strategy, time.Minute)
+			for endpoint, spent := range tt.exhausted {
+				for _, i := range spent {
+					p.creds[i].observe(endpoint, rateLimited(reset), nil, time.Minute)
+				}
+			}
+			for endpoint, calls := range tt.used {
+				for _, i := range calls {
+					p.creds[i].observe(endpoint, &http.Response{StatusCode: http.StatusOK}, nil, time.Minute)
+				}
+			}
+			c, err := p.pick(tt.endpoint)
+			if code := errorClass(err); err != nil && code != tt.wantCode || err == nil && tt.wantCode != "" {
+				t.Fatalf("pick() = %v, want code %q", err, tt.wantCode)
+			}
+			if err == nil && c.index != tt.want {
+				t.Errorf("pick() = credential %s, want %s", c.index, tt.want)
+			}
+		})
+	}
+}
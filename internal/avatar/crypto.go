@@ -0,0 +1,66 @@
+package avatar
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// sealer encrypts and authenticates small values, such as OAuth tokens at
+// rest and OAuth state in cookies, with AES-256-GCM.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer takes a base64 encoded 32 byte key.
+func newSealer(key string) (*sealer, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("config: TokenEncryptionKey must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal encodes v as JSON and encrypts it. purpose is bound to the ciphertext,
+// so a value sealed for one use can't be replayed for another.
+func (s *sealer) seal(purpose string, v interface{}) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(purpose))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed for purpose into v.
+func (s *sealer) open(purpose string, sealed string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return fmt.Errorf("sealer: %w", err)
+	}
+	n := s.aead.NonceSize()
+	if len(raw) < n {
+		return errors.New("sealer: value too short")
+	}
+	plain, err := s.aead.Open(nil, raw[:n], raw[n:], []byte(purpose))
+	if err != nil {
+		return fmt.Errorf("sealer: %w", err)
+	}
+	return json.Unmarshal(plain, v)
+}
@@ -0,0 +1,266 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"math"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	//badgeThreshold is the confidence above which the badge counts as found
+	badgeThreshold = 0.9
+	//avatars are searched at this size, the logo is simple enough
+	detectSize = 128
+	//how much the holes of the logo must differ from its color, as a
+	//fraction of the full range, for a match to count in full
+	minHoleContrast = 0.2
+	//largest image accepted by the detect endpoint
+	maxDetectBytes = 5 << 20
+)
+
+// badge widths tried, relative to the avatar width: composite puts the
+// 200px logo on 400px avatars, other tools use other sizes
+var detectScales = []float64{0.2, 0.25, 0.3, 0.35, 0.4, 0.45, 0.5, 0.55, 0.6}
+
+// badgeMatch is where the badge was found in an avatar, in the avatar's
+// pixels.
+type badgeMatch struct {
+	Found      bool    `json:"found"`
+	Confidence float64 `json:"confidence"`
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	//Scale is the badge width relative to the avatar width
+	Scale float64 `json:"scale"`
+}
+
+// badgeTemplate is a scaled badge, split into its opaque pixels and the
+// transparent ones, where the avatar shows through.
+type badgeTemplate struct {
+	w, h    int
+	pts     []templatePoint
+	holes   []image.Point
+	r, g, b float64 //mean color of pts
+}
+
+type templatePoint struct {
+	x, y    int
+	r, g, b float64
+}
+
+// detectBadge looks for badge anywhere in avatar at several scales, by
+// matching it against every position. Confidence is one minus the mean
+// color difference, so 1 is a perfect match and unrelated images land
+// around 0.6 to 0.8.
+func detectBadge(avatar, badge image.Image) badgeMatch {
+	b := avatar.Bounds()
+	if b.Dx() < 16 || b.Dy() < 16 {
+		return badgeMatch{}
+	}
+	//search a downscaled copy, and map the result back
+	ratio := float64(detectSize) / float64(max(b.Dx(), b.Dy()))
+	sw, sh := max(int(float64(b.Dx())*ratio), 1), max(int(float64(b.Dy())*ratio), 1)
+	small := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), avatar, b, xdraw.Src, nil)
+
+	var best struct {
+		score float64
+		x, y  int
+		t     *badgeTemplate
+		scale float64
+	}
+	best.score = -1
+	for _, scale := range detectScales {
+		t := newBadgeTemplate(badge, int(float64(sw)*scale))
+		if t == nil || t.w > sw || t.h > sh {
+			continue
+		}
+		//coarse pass, then refine around the best coarse position
+		const stride = 4
+		bx, by, bs := 0, 0, -1.0
+		for y := 0; y <= sh-t.h; y += stride {
+			for x := 0; x <= sw-t.w; x += stride {
+				if s := t.score(small, x, y); s > bs {
+					bx, by, bs = x, y, s
+				}
+			}
+		}
+		for y := max(by-stride+1, 0); y <= min(by+stride-1, sh-t.h); y++ {
+			for x := max(bx-stride+1, 0); x <= min(bx+stride-1, sw-t.w); x++ {
+				if s := t.score(small, x, y); s > bs {
+					bx, by, bs = x, y, s
+				}
+			}
+		}
+		if bs > best.score {
+			best.score, best.x, best.y, best.t, best.scale = bs, bx, by, t, scale
+		}
+	}
+	if best.t == nil {
+		return badgeMatch{}
+	}
+	confidence := math.Round(best.score*1000) / 1000
+	return badgeMatch{
+		Found:      confidence >= badgeThreshold,
+		Confidence: confidence,
+		X:          b.Min.X + int(float64(best.x)/ratio),
+		Y:          b.Min.Y + int(float64(best.y)/ratio),
+		Width:      int(float64(best.t.w) / ratio),
+		Height:     int(float64(best.t.h) / ratio),
+		Scale:      best.scale,
+	}
+}
+
+// newBadgeTemplate scales badge to width w and keeps its opaque pixels.
+func newBadgeTemplate(badge image.Image, w int) *badgeTemplate {
+	bb := badge.Bounds()
+	h := w * bb.Dy() / bb.Dx()
+	if w < 6 || h < 6 {
+		return nil
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), badge, bb, xdraw.Src, nil)
+	t := &badgeTemplate{w: w, h: h}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := scaled.PixOffset(x, y)
+			switch a := scaled.Pix[i+3]; {
+			case a >= 200:
+				p := templatePoint{x, y, float64(scaled.Pix[i]), float64(scaled.Pix[i+1]), float64(scaled.Pix[i+2])}
+				t.pts = append(t.pts, p)
+				t.r, t.g, t.b = t.r+p.r, t.g+p.g, t.b+p.b
+			case a < 50:
+				t.holes = append(t.holes, image.Pt(x, y))
+			}
+		}
+	}
+	if len(t.pts) == 0 {
+		return nil
+	}
+	n := float64(len(t.pts))
+	t.r, t.g, t.b = t.r/n, t.g/n, t.b/n
+	return t
+}
+
+// score matches t against img with its top left corner at x, y. The opaque
+// pixels must match the logo, and the holes must not look like the logo:
+// otherwise any patch of the logo's blue would match.
+func (t *badgeTemplate) score(img *image.RGBA, x, y int) float64 {
+	var diff float64
+	for _, p := range t.pts {
+		i := img.PixOffset(x+p.x, y+p.y)
+		diff += math.Abs(p.r-float64(img.Pix[i])) +
+			math.Abs(p.g-float64(img.Pix[i+1])) +
+			math.Abs(p.b-float64(img.Pix[i+2]))
+	}
+	match := 1 - diff/float64(3*len(t.pts))/255
+	if len(t.holes) == 0 {
+		return match
+	}
+	var contrast float64
+	for _, p := range t.holes {
+		i := img.PixOffset(x+p.X, y+p.Y)
+		contrast += math.Abs(t.r-float64(img.Pix[i])) +
+			math.Abs(t.g-float64(img.Pix[i+1])) +
+			math.Abs(t.b-float64(img.Pix[i+2]))
+	}
+	contrast /= float64(3*len(t.holes)) * 255
+	return match * math.Min(1, contrast/minHoleContrast)
+}
+
+// Detect reports whether an avatar already carries the Mastodon badge, and
+// where. GET takes a username, POST takes the image as the request body.
+func Detect(w http.ResponseWriter, r *http.Request) {
+	serve("detect", serveDetect)(w, r)
+}
+
+func serveDetect(w http.ResponseWriter, r *http.Request) {
+	if configErr != nil {
+		writeError(w, r, errMisconfigured(configErr))
+		return
+	}
+	badge, err := decodeBadge()
+	if err != nil {
+		writeError(w, r, errMisconfigured(err))
+		return
+	}
+	var body []byte
+	switch r.Method {
+	case http.MethodGet:
+		username := r.URL.Query().Get("username")
+		if username == "" {
+			writeError(w, r, errMissingUsername())
+			return
+		}
+		if err := checkOptOut(username); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		body, err = fetchUserAvatar(r.Context(), username)
+	case http.MethodPost:
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxDetectBytes+1))
+		if err == nil && len(body) > maxDetectBytes {
+			err = &apiError{Status: http.StatusRequestEntityTooLarge, Code: "image_too_large", Message: "The image must be at most 5 MB."}
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		err = &apiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Use GET or POST."}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	release, err := acquireRenderSlot(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer release()
+	img, err := decodeImage(r.Context(), body)
+	if errors.Is(err, errImagePixels) {
+		err = &apiError{Status: http.StatusRequestEntityTooLarge, Code: "image_too_large", Message: "The image must be at most 16 megapixels.", Err: err}
+	} else if err != nil {
+		err = errAvatarDecode(err)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detectBadge(img, badge))
+}
+
+// fetchUserAvatar downloads the full size avatar of a Twitter user.
+func fetchUserAvatar(ctx context.Context, username string) ([]byte, error) {
+	usr, err := lookupUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Protected {
+		return nil, errUserProtected(username)
+	}
+	if err := avatarBreaker.allow(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	body, err := downloadAvatar(ctx, upstreamClient, originalAvatarURL(usr))
+	avatarBreaker.record(err)
+	return body, err
+}
+
+// hasBadge reports whether img already shows the bundled badge, so a
+// regenerated avatar doesn't get a second one.
+func hasBadge(img image.Image) bool {
+	badge, err := decodeBadge()
+	if err != nil {
+		return false
+	}
+	return detectBadge(img, badge).Found
+}
@@ -0,0 +1,115 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hugeGIF is a tiny GIF whose header claims a w×h canvas.
+func hugeGIF(t *testing.T, w, h uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), []color.Color{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	//the logical screen size follows the 6 byte signature
+	binary.LittleEndian.PutUint16(b[6:], w)
+	binary.LittleEndian.PutUint16(b[8:], h)
+	return b
+}
+
+func TestDetectPixelBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "avatar", body: encodePNG(t, image.NewRGBA(image.Rect(0, 0, 400, 400))), wantStatus: http.StatusOK},
+		{name: "at the budget", body: hugeGIF(t, 4096, 4096), wantStatus: http.StatusOK},
+		{name: "over the budget", body: hugeGIF(t, 65535, 65535), wantStatus: http.StatusRequestEntityTooLarge, wantCode: "image_too_large"},
+		{name: "one row too many", body: hugeGIF(t, 4096, 4097), wantStatus: http.StatusRequestEntityTooLarge, wantCode: "image_too_large"},
+		{name: "not an image", body: []byte("hello"), wantStatus: http.StatusUnprocessableEntity, wantCode: "avatar_undecodable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, testConfig(t, "http://localhost"))
+			rec := httptest.NewRecorder()
+			serveDetect(rec, httptest.NewRequest(http.MethodPost, "/api/detect", bytes.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if code := errorCode(t, rec); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// badgedAvatar is a flat 400px avatar with the bundled badge composited on,
+// the way /api/mastodon draws it.
+func badgedAvatar(t *testing.T, badge image.Image, c color.Color) image.Image {
+	t.Helper()
+	img, err := composite(flatImage(400, 400, c), style{Badge: badge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func flatImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestDetectBadgeThreshold(t *testing.T) {
+	badge, err := decodeBadge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := color.RGBA{0x80, 0x80, 0x80, 0xff}
+	//the badge's own blue, so only its holes can tell it apart
+	blue := color.RGBA{0x01, 0x87, 0xd1, 0xff}
+	tests := []struct {
+		name      string
+		avatar    image.Image
+		wantFound bool
+		minConf   float64
+		maxConf   float64
+	}{
+		{name: "badged avatar", avatar: badgedAvatar(t, badge, gray), wantFound: true, minConf: badgeThreshold, maxConf: 1},
+		{name: "plain avatar", avatar: flatImage(400, 400, gray), maxConf: badgeThreshold},
+		{name: "avatar in the badge color", avatar: flatImage(400, 400, blue), maxConf: badgeThreshold},
+		{name: "too small to search", avatar: flatImage(8, 8, gray)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := detectBadge(tt.avatar, badge)
+			if m.Found != tt.wantFound {
+				t.Errorf("Found = %v, want %v (confidence %v)", m.Found, tt.wantFound, m.Confidence)
+			}
+			if m.Confidence < tt.minConf || m.Confidence > tt.maxConf {
+				t.Errorf("confidence = %v, want between %v and %v", m.Confidence, tt.minConf, tt.maxConf)
+			}
+		})
+	}
+}
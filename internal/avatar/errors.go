@@ -0,0 +1,218 @@
+package avatar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// apiError is a failure with a distinct, machine-readable outcome. It is
+// rendered by writeError as a JSON body with the matching status code.
+type apiError struct {
+	Status     int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *apiError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	return e.Code
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+// Twitter API error codes, see
+// https://developer.twitter.com/en/support/twitter-api/error-troubleshooting
+const (
+	twitterCodeNoUserMatches = 17
+	twitterCodeBadAuth       = 32
+	twitterCodeUserNotFound  = 50
+	twitterCodeSuspended     = 63
+	twitterCodeRateLimited   = 88
+	twitterCodeInvalidToken  = 89
+	twitterCodeBadAuthData   = 215
+)
+
+func errMissingUsername() error {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    "missing_username",
+		Message: "Add your twitter username as a query parameter: https://mastodon-in-twitter-avatar.vercel.app/api/mastodon?username=<YOUR_TWITTER_USERNAME>",
+	}
+}
+
+func errUserProtected(username string) error {
+	return &apiError{
+		Status:  http.StatusForbidden,
+		Code:    "user_protected",
+		Message: fmt.Sprintf("The account @%s is protected.", username),
+	}
+}
+
+func errAvatarFetch(err error) error {
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Code:    "avatar_fetch_failed",
+		Message: "The avatar image could not be downloaded.",
+		Err:     err,
+	}
+}
+
+func errAvatarTooLarge() error {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "avatar_too_large",
+		Message: fmt.Sprintf("The avatar image is larger than %d MB.", maxAvatarBytes>>20),
+	}
+}
+
+func errAvatarDecode(err error) error {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "avatar_undecodable",
+		Message: "The avatar image could not be decoded.",
+		Err:     err,
+	}
+}
+
+func errMisconfigured(err error) error {
+	return &apiError{
+		Status:  http.StatusInternalServerError,
+		Code:    "misconfigured",
+		Message: "The service is misconfigured.",
+		Err:     err,
+	}
+}
+
+// upstreamError maps a failed upstream call onto an apiError: a missed
+// deadline becomes an upstream_timeout, a refused address an
+// address_not_allowed, cancellation is passed through untouched and anything
+// else is wrapped by orElse.
+func upstreamError(err error, orElse func(error) error) error {
+	switch {
+	case errors.Is(err, errNotPublic):
+		return &apiError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "address_not_allowed",
+			Message: "The URL must be https and point to a public address.",
+			Err:     err,
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &apiError{
+			Status:  http.StatusGatewayTimeout,
+			Code:    "upstream_timeout",
+			Message: "An upstream took too long to answer.",
+			Err:     err,
+		}
+	case errors.Is(err, context.Canceled):
+		return err
+	}
+	return orElse(err)
+}
+
+// twitterError maps a failed users/show call onto an apiError.
+func twitterError(username string, resp *http.Response, err error) error {
+	var e *apiError
+	if errors.As(err, &e) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return upstreamError(err, func(err error) error { return err })
+	}
+	var apiErr twitter.APIError
+	code := 0
+	if errors.As(err, &apiErr) && !apiErr.Empty() {
+		code = apiErr.Errors[0].Code
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	switch {
+	case code == twitterCodeUserNotFound || code == twitterCodeNoUserMatches || status == http.StatusNotFound:
+		return &apiError{
+			Status:  http.StatusNotFound,
+			Code:    "user_not_found",
+			Message: fmt.Sprintf("The account @%s does not exist.", username),
+			Err:     err,
+		}
+	case code == twitterCodeSuspended:
+		return &apiError{
+			Status:  http.StatusGone,
+			Code:    "user_suspended",
+			Message: fmt.Sprintf("The account @%s is suspended.", username),
+			Err:     err,
+		}
+	case code == twitterCodeRateLimited || status == http.StatusTooManyRequests:
+		return &apiError{
+			Status:     http.StatusTooManyRequests,
+			Code:       "rate_limited",
+			Message:    "Twitter is rate limiting us, try again later.",
+			RetryAfter: rateLimitReset(resp),
+			Err:        err,
+		}
+	case code == twitterCodeBadAuth || code == twitterCodeInvalidToken || code == twitterCodeBadAuthData ||
+		status == http.StatusUnauthorized:
+		return errMisconfigured(err)
+	}
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Code:    "twitter_unavailable",
+		Message: "Twitter could not be reached.",
+		Err:     err,
+	}
+}
+
+// rateLimitReset reads the time until the rate limit window resets from a
+// Twitter response.
+func rateLimitReset(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	d := time.Until(time.Unix(reset, 0))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// writeError answers the request with a JSON error body. Errors that are not
+// an apiError are reported as an opaque internal error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	loggerFrom(r.Context()).Warn("request failed", errorAttrs(err)...)
+	var e *apiError
+	if !errors.As(err, &e) {
+		e = &apiError{
+			Status:  http.StatusInternalServerError,
+			Code:    "internal_error",
+			Message: "Oops",
+		}
+	}
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    e.Code,
+			"message": e.Message,
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package avatar
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup deduplicates concurrent renders per cache key, like
+// singleflight, but runs each render on its own context that is cancelled
+// once every caller waiting on it has gone away.
+type flightGroup struct {
+	mu sync.Mutex
+	m  map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	png     []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do returns the result of fn for key, joining a render already in flight if
+// there is one. It returns early with ctx's error if ctx is done first.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flight)
+	}
+	f, ok := g.m[key]
+	if !ok {
+		//keep the first caller's logger and trace, but not its cancellation
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.m[key] = f
+		go func() {
+			f.png, f.err = fn(fctx)
+			g.forget(key, f)
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.png, f.err
+	case <-ctx.Done():
+		g.leave(key, f)
+		return nil, ctx.Err()
+	}
+}
+
+// leave drops a waiter from f. The last one to leave cancels f and removes it
+// from the group under the same lock, so no caller can join f in between and
+// get its cancellation.
+func (g *flightGroup) leave(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	if g.m[key] == f {
+		delete(g.m, key)
+	}
+	f.cancel()
+}
+
+// forget cancels f and removes it from the group, so later callers start a
+// new render.
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mu.Lock()
+	if g.m[key] == f {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+	f.cancel()
+}
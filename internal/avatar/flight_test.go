@@ -0,0 +1,162 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	errRender := errors.New("render failed")
+	tests := []struct {
+		name    string
+		callers int
+		png     []byte
+		err     error
+	}{
+		{name: "one caller", callers: 1, png: []byte("png")},
+		{name: "concurrent callers share the render", callers: 10, png: []byte("png")},
+		{name: "concurrent callers share the error", callers: 10, err: errRender},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g flightGroup
+			var calls int32
+			release := make(chan struct{})
+			fn := func(ctx context.Context) ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return tt.png, tt.err
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					png, err := g.do(context.Background(), "key", fn)
+					if string(png) != string(tt.png) || !errors.Is(err, tt.err) {
+						t.Errorf("do() = %q, %v, want %q, %v", png, err, tt.png, tt.err)
+					}
+				}()
+			}
+			waitForWaiters(t, &g, "key", tt.callers)
+			close(release)
+			wg.Wait()
+
+			if calls != 1 {
+				t.Errorf("fn ran %d times, want 1", calls)
+			}
+			if _, ok := g.m["key"]; ok {
+				t.Error("finished flight is still in the group")
+			}
+		})
+	}
+}
+
+func TestFlightGroupSequentialCallsRunAgain(t *testing.T) {
+	var g flightGroup
+	var calls int32
+	fn := func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte("png"), nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := g.do(context.Background(), "key", fn); err != nil {
+			t.Fatalf("do() = %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("fn ran %d times, want 3", calls)
+	}
+}
+
+func TestFlightGroupCancelsAbandonedRender(t *testing.T) {
+	var g flightGroup
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) ([]byte, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "key", fn)
+		errc <- err
+	}()
+	waitForWaiters(t, &g, "key", 1)
+	cancel()
+
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("do() = %v, want context.Canceled", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned render was not cancelled")
+	}
+}
+
+// The last waiter to leave must take the flight out of the group before
+// anyone else can take the lock, or a caller joining in between would get the
+// cancelled render.
+func TestFlightGroupLeave(t *testing.T) {
+	tests := []struct {
+		name          string
+		waiters       int
+		wantCancelled bool
+	}{
+		{name: "other waiters remain", waiters: 2, wantCancelled: false},
+		{name: "last waiter leaves", waiters: 1, wantCancelled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			f := &flight{done: make(chan struct{}), waiters: tt.waiters, cancel: cancel}
+			g := flightGroup{m: map[string]*flight{"key": f}}
+
+			g.leave("key", f)
+
+			_, inGroup := g.m["key"]
+			if cancelled := ctx.Err() != nil; cancelled != tt.wantCancelled {
+				t.Errorf("cancelled = %v, want %v", cancelled, tt.wantCancelled)
+			}
+			if inGroup == tt.wantCancelled {
+				t.Errorf("flight in group = %v, want %v", inGroup, !tt.wantCancelled)
+			}
+			if !tt.wantCancelled {
+				return
+			}
+			//a caller arriving now starts a render of its own
+			png, err := g.do(context.Background(), "key", func(ctx context.Context) ([]byte, error) {
+				return []byte("png"), ctx.Err()
+			})
+			if err != nil || string(png) != "png" {
+				t.Errorf("do() after leave = %q, %v, want a fresh render", png, err)
+			}
+		})
+	}
+}
+
+// waitForWaiters blocks until n callers wait on the flight for key.
+func waitForWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		f, ok := g.m[key]
+		joined := ok && f.waiters == n
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers did not join the flight for %q", n, key)
+}
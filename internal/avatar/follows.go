@@ -0,0 +1,450 @@
+package avatar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Follow job states.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+const (
+	friendsPageSize   = 200
+	webFingerParallel = 4
+)
+
+var (
+	//find-my-follows jobs: running ones are bounded by followSlots, and
+	//queued ones, those waiting for a slot, by maxQueuedFollowJobs
+	followJobs = struct {
+		sync.Mutex
+		byID   map[string]*followJob
+		byKey  map[string]*followJob
+		queued int
+	}{byID: map[string]*followJob{}, byKey: map[string]*followJob{}}
+	followSlots         chan struct{}
+	followJobTTL        time.Duration
+	maxQueuedFollowJobs int
+	followQueueTimeout  time.Duration
+)
+
+// followJob pages through the accounts a Twitter user follows and collects
+// the Fediverse handles in their profiles.
+type followJob struct {
+	mu       sync.Mutex
+	status   followJobStatus
+	handles  []string
+	key      string
+	finished time.Time
+}
+
+// followJobStatus is the progress report of a followJob.
+type followJobStatus struct {
+	ID               string `json:"id"`
+	Username         string `json:"username"`
+	WebFinger        bool   `json:"webfinger"`
+	State            string `json:"state"`
+	Pages            int    `json:"pages"`
+	AccountsTotal    int    `json:"accounts_total"`
+	AccountsScanned  int    `json:"accounts_scanned"`
+	HandlesFound     int    `json:"handles_found"`
+	HandlesValidated int    `json:"handles_validated,omitempty"`
+	//RateLimitedUntil is set while the job waits for Twitter
+	RateLimitedUntil *time.Time `json:"rate_limited_until,omitempty"`
+	Error            string     `json:"error,omitempty"`
+}
+
+// Follows runs find-my-follows jobs. POST starts one for the username query
+// parameter, GET with job=<id> reports its progress, and adding format=csv
+// downloads the result as a Mastodon following_accounts.csv import.
+func Follows(w http.ResponseWriter, r *http.Request) {
+	serve("follows", serveFollows)(w, r)
+}
+
+func serveFollows(w http.ResponseWriter, r *http.Request) {
+	if configErr != nil {
+		writeError(w, r, errMisconfigured(configErr))
+		return
+	}
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodPost:
+		startFollowJob(w, r)
+	case http.MethodGet:
+		job := lookupFollowJob(q.Get("job"))
+		if job == nil {
+			writeError(w, r, &apiError{Status: http.StatusNotFound, Code: "job_not_found", Message: "There is no such job, it may have expired."})
+			return
+		}
+		if q.Get("format") == "csv" {
+			writeFollowCSV(w, r, job)
+			return
+		}
+		writeJSON(w, http.StatusOK, job.snapshot())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, r, &apiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Use GET or POST."})
+	}
+}
+
+func startFollowJob(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	username := normalizeUsername(q.Get("username"))
+	if username == "" {
+		writeError(w, r, errMissingUsername())
+		return
+	}
+	if err := checkOptOut(username); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	webFinger := false
+	if v := q.Get("webfinger"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, errInvalidOption("webfinger", "must be true or false"))
+			return
+		}
+		webFinger = b
+	}
+
+	key := username + "|" + strconv.FormatBool(webFinger)
+	followJobs.Lock()
+	sweepFollowJobs()
+	job, ok := followJobs.byKey[key]
+	if !ok && followJobs.queued >= maxQueuedFollowJobs {
+		followJobs.Unlock()
+		writeError(w, r, &apiError{
+			Status:     http.StatusServiceUnavailable,
+			Code:       "busy",
+			Message:    "Too many find-my-follows jobs are waiting, try again later.",
+			RetryAfter: time.Minute,
+		})
+		return
+	}
+	if !ok {
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err != nil {
+			followJobs.Unlock()
+			writeError(w, r, err)
+			return
+		}
+		job = &followJob{key: key, status: followJobStatus{
+			ID:        base64.RawURLEncoding.EncodeToString(id),
+			Username:  username,
+			WebFinger: webFinger,
+			State:     jobQueued,
+		}}
+		followJobs.byID[job.status.ID] = job
+		followJobs.byKey[key] = job
+		followJobs.queued++
+		//the job outlives the request, but keeps its logger and trace
+		go job.run(context.WithoutCancel(r.Context()))
+	}
+	followJobs.Unlock()
+
+	status := job.snapshot()
+	statusURL := "/api/follows?job=" + url.QueryEscape(status.ID)
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job":        status,
+		"status_url": statusURL,
+		"csv_url":    statusURL + "&format=csv",
+	})
+}
+
+// leaveFollowQueue counts a job out of the queue once it starts or gives up.
+func leaveFollowQueue() {
+	followJobs.Lock()
+	followJobs.queued--
+	followJobs.Unlock()
+}
+
+func lookupFollowJob(id string) *followJob {
+	followJobs.Lock()
+	defer followJobs.Unlock()
+	sweepFollowJobs()
+	return followJobs.byID[id]
+}
+
+// sweepFollowJobs forgets jobs that finished more than followJobTTL ago.
+// The caller holds the lock.
+func sweepFollowJobs() {
+	for id, job := range followJobs.byID {
+		job.mu.Lock()
+		expired := !job.finished.IsZero() && time.Since(job.finished) > followJobTTL
+		job.mu.Unlock()
+		if expired {
+			delete(followJobs.byID, id)
+			delete(followJobs.byKey, job.key)
+		}
+	}
+}
+
+func (j *followJob) snapshot() followJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *followJob) update(f func(*followJobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f(&j.status)
+}
+
+// run waits for a job slot, then does the job. A job that waits longer than
+// followQueueTimeout fails without running.
+func (j *followJob) run(ctx context.Context) {
+	var handles []string
+	var err error
+	timer := time.NewTimer(followQueueTimeout)
+	select {
+	case followSlots <- struct{}{}:
+		timer.Stop()
+		leaveFollowQueue()
+		defer func() { <-followSlots }()
+		j.update(func(s *followJobStatus) { s.State = jobRunning })
+
+		handles, err = j.collect(ctx)
+		if err == nil && j.snapshot().WebFinger {
+			handles = j.validate(ctx, handles)
+		}
+	case <-timer.C:
+		leaveFollowQueue()
+		err = &apiError{
+			Status:  http.StatusServiceUnavailable,
+			Code:    "job_expired",
+			Message: "The job waited too long for a free slot, start it again later.",
+		}
+	}
+
+	j.mu.Lock()
+	j.finished = time.Now()
+	j.handles = handles
+	j.status.State = jobDone
+	if err != nil {
+		j.status.State = jobFailed
+		j.status.Error = "The job failed."
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			j.status.Error = apiErr.Message
+		}
+	}
+	status := j.status
+	j.mu.Unlock()
+
+	if err != nil {
+		loggerFrom(ctx).Warn("follow job failed", append([]any{"job", status.ID}, errorAttrs(err)...)...)
+		//let the next request start over instead of reading the failure
+		followJobs.Lock()
+		if followJobs.byKey[j.key] == j {
+			delete(followJobs.byKey, j.key)
+		}
+		followJobs.Unlock()
+		return
+	}
+	loggerFrom(ctx).Info("follow job done", "job", status.ID, "username", logUser(status.Username),
+		"scanned", status.AccountsScanned, "handles", len(handles))
+}
+
+// collect pages through the friends list and keeps the best handle of
+// every friend that has one.
+func (j *followJob) collect(ctx context.Context) ([]string, error) {
+	username := j.snapshot().Username
+	usr, err := lookupUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Protected {
+		return nil, errUserProtected(username)
+	}
+	j.update(func(s *followJobStatus) { s.AccountsTotal = usr.FriendsCount })
+
+	var handles []string
+	seen := map[string]bool{}
+	skipStatus, withEntities := true, true
+	for cursor := int64(-1); cursor != 0; {
+		var page *twitter.Friends
+		err := j.waitForRateLimit(ctx, func() error {
+			lctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+			defer cancel()
+			resp, err := twitterPool.do(lctx, endpointFriendsList, func(client *twitter.Client) (resp *http.Response, err error) {
+				page, resp, err = client.Friends.List(&twitter.FriendListParams{
+					ScreenName:          username,
+					Cursor:              cursor,
+					Count:               friendsPageSize,
+					SkipStatus:          &skipStatus,
+					IncludeUserEntities: &withEntities,
+				})
+				return resp, err
+			})
+			if err != nil {
+				return twitterError(username, resp, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Users {
+			candidates := findHandles(userTexts(&page.Users[i]))
+			if len(candidates) == 0 {
+				continue
+			}
+			h := strings.ToLower(candidates[0].Handle)
+			if !seen[h] {
+				seen[h] = true
+				handles = append(handles, candidates[0].Handle)
+			}
+		}
+		j.update(func(s *followJobStatus) {
+			s.Pages++
+			s.AccountsScanned += len(page.Users)
+			s.HandlesFound = len(handles)
+		})
+		cursor = page.NextCursor
+	}
+	return handles, nil
+}
+
+// waitForRateLimit runs call, and again after the reset whenever Twitter
+// rate limits it. Large accounts need more pages than one window allows.
+func (j *followJob) waitForRateLimit(ctx context.Context, call func() error) error {
+	for {
+		err := call()
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) || apiErr.Code != "rate_limited" {
+			return err
+		}
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = time.Minute
+		}
+		until := time.Now().Add(wait)
+		j.update(func(s *followJobStatus) { s.RateLimitedUntil = &until })
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		j.update(func(s *followJobStatus) { s.RateLimitedUntil = nil })
+	}
+}
+
+// validate keeps the handles that WebFinger resolves, in their canonical
+// form.
+func (j *followJob) validate(ctx context.Context, handles []string) []string {
+	valid := make([]string, len(handles))
+	sem := make(chan struct{}, webFingerParallel)
+	var wg sync.WaitGroup
+	for i, handle := range handles {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			h, err := parseHandle(handle)
+			if err != nil {
+				return
+			}
+			wctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+			defer cancel()
+			canonical, err := webFinger(wctx, h)
+			if err != nil {
+				loggerFrom(ctx).Debug("webfinger failed", append([]any{"handle", logUser(handle)}, errorAttrs(err)...)...)
+				return
+			}
+			valid[i] = canonical
+			j.update(func(s *followJobStatus) { s.HandlesValidated++ })
+		}()
+	}
+	wg.Wait()
+
+	out := valid[:0]
+	for _, h := range valid {
+		if h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// webFinger resolves h and returns the account address its instance
+// reports, which may differ from h in case or domain.
+func webFinger(ctx context.Context, h fediHandle) (string, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     h.Instance,
+		Path:     "/.well-known/webfinger",
+		RawQuery: url.Values{"resource": {"acct:" + h.String()}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/jrd+json")
+	resp, err := fediverseClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webfinger %s: unexpected status %s", h, resp.Status)
+	}
+	var jrd struct {
+		Subject string `json:"subject"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jrd); err != nil {
+		return "", err
+	}
+	canonical, err := parseHandle(strings.TrimPrefix(jrd.Subject, "acct:"))
+	if err != nil {
+		return "", err
+	}
+	return canonical.String(), nil
+}
+
+// writeFollowCSV writes the handles of a finished job in the format of
+// Mastodon's following list import.
+func writeFollowCSV(w http.ResponseWriter, r *http.Request, job *followJob) {
+	job.mu.Lock()
+	state, username, handles := job.status.State, job.status.Username, job.handles
+	job.mu.Unlock()
+	if state != jobDone {
+		message := fmt.Sprintf("The job is %s, the CSV is ready once it is done.", state)
+		if state == jobFailed {
+			message = "The job failed, start a new one."
+		}
+		writeError(w, r, &apiError{Status: http.StatusConflict, Code: "job_not_done", Message: message})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="following_accounts_%s.csv"`, username))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Account address", "Show boosts", "Notify on new posts", "Languages"})
+	for _, h := range handles {
+		cw.Write([]string{h, "true", "false", ""})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		loggerFrom(r.Context()).Warn("writing response failed", "error", err)
+	}
+}
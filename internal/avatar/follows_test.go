@@ -0,0 +1,124 @@
+package avatar
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFollowJobQueue(t *testing.T) {
+	tests := []struct {
+		name           string
+		usernames      []string
+		wait           bool //for the queued jobs to expire before the last request
+		wantStatus     int
+		wantCode       string
+		wantSameJob    bool
+		wantQueued     int
+		wantRetryAfter string
+	}{
+		{name: "queue has room", usernames: []string{"jack"}, wantStatus: http.StatusAccepted, wantQueued: 1},
+		{name: "same job again", usernames: []string{"jack", "jack"}, wantStatus: http.StatusAccepted, wantSameJob: true, wantQueued: 1},
+		{name: "queue full", usernames: []string{"jack", "elon"}, wantStatus: http.StatusServiceUnavailable, wantCode: "busy", wantQueued: 1, wantRetryAfter: "60"},
+		{name: "expired jobs leave the queue", usernames: []string{"jack", "elon"}, wait: true, wantStatus: http.StatusAccepted, wantQueued: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testConfig(t, "http://localhost")
+			conf.MaxFollowJobs, conf.MaxQueuedFollowJobs = 1, 1
+			conf.FollowQueueTimeout = 50 * time.Millisecond
+			useConfig(t, conf)
+			followJobs.Lock()
+			followJobs.byID, followJobs.byKey, followJobs.queued = map[string]*followJob{}, map[string]*followJob{}, 0
+			followJobs.Unlock()
+			//the only slot is taken, so jobs stay queued until they expire
+			followSlots <- struct{}{}
+			t.Cleanup(func() {
+				waitForFollowQueue(t, 0)
+				<-followSlots
+			})
+
+			var rec *httptest.ResponseRecorder
+			var ids []string
+			for i, username := range tt.usernames {
+				if tt.wait && i == len(tt.usernames)-1 {
+					waitForFollowQueue(t, 0)
+				}
+				rec = httptest.NewRecorder()
+				serveFollows(rec, httptest.NewRequest(http.MethodPost, "/api/follows?username="+username, nil))
+				var body struct {
+					Job followJobStatus `json:"job"`
+				}
+				if rec.Code == http.StatusAccepted {
+					if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+						t.Fatal(err)
+					}
+					ids = append(ids, body.Job.ID)
+				}
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if code := errorCode(t, rec); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if sameJob := len(ids) == 2 && ids[0] == ids[1]; sameJob != tt.wantSameJob {
+				t.Errorf("job IDs %q, want the same job %v", ids, tt.wantSameJob)
+			}
+			followJobs.Lock()
+			queued := followJobs.queued
+			followJobs.Unlock()
+			if queued != tt.wantQueued {
+				t.Errorf("%d jobs queued, want %d", queued, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestFollowJobExpiresInQueue(t *testing.T) {
+	conf := testConfig(t, "http://localhost")
+	conf.MaxFollowJobs = 1
+	conf.FollowQueueTimeout = 10 * time.Millisecond
+	useConfig(t, conf)
+	followSlots <- struct{}{}
+	defer func() { <-followSlots }()
+
+	job := &followJob{key: "jack|false", status: followJobStatus{ID: "job", Username: "jack", State: jobQueued}}
+	followJobs.Lock()
+	followJobs.byKey[job.key] = job
+	followJobs.queued++
+	followJobs.Unlock()
+	job.run(context.Background())
+
+	if s := job.snapshot(); s.State != jobFailed || s.Error == "" {
+		t.Errorf("job = %+v, want failed with an error", s)
+	}
+	followJobs.Lock()
+	_, kept := followJobs.byKey[job.key]
+	followJobs.Unlock()
+	if kept {
+		t.Error("expired job still answers new requests")
+	}
+}
+
+// waitForFollowQueue blocks until n follow jobs are queued.
+func waitForFollowQueue(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		followJobs.Lock()
+		queued := followJobs.queued
+		followJobs.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("follow queue did not reach %d jobs", n)
+}
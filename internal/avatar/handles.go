@@ -0,0 +1,278 @@
+package avatar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Where in the Twitter profile a handle was found.
+const (
+	sourceName        = "name"
+	sourceDescription = "description"
+	sourceLocation    = "location"
+	sourceURL         = "url"
+	sourcePinnedTweet = "pinned_tweet"
+)
+
+var (
+	//@user@instance, or user@instance which might as well be an email address
+	handleText = regexp.MustCompile(`(?i)(^|[^\w@/.])(@?)([a-z0-9_][a-z0-9_.-]*)@([a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,})`)
+	//https://instance/@user, https://instance/@user@other and https://instance/users/user
+	profileURL = regexp.MustCompile(`(?i)https?://([a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,})/(?:@|users/)([a-z0-9_][a-z0-9_.-]*)(?:@([a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}))?`)
+
+	//mail providers, whose user@host is an email address
+	mailHosts = map[string]bool{
+		"gmail.com": true, "googlemail.com": true, "outlook.com": true, "hotmail.com": true, "live.com": true,
+		"yahoo.com": true, "icloud.com": true, "me.com": true, "aol.com": true, "gmx.de": true, "gmx.net": true,
+		"proton.me": true, "protonmail.com": true, "fastmail.com": true, "hey.com": true,
+	}
+	//sites with /@user profile URLs that aren't on the Fediverse
+	nonFediHosts = map[string]bool{
+		"medium.com": true, "youtube.com": true, "www.youtube.com": true, "tiktok.com": true,
+		"www.tiktok.com": true, "threads.net": true, "www.threads.net": true, "substack.com": true,
+	}
+
+	//how much a mention counts by its form and by where it is
+	formWeight   = map[string]float64{"at": 0.6, "url": 0.5, "bare": 0.25}
+	sourceWeight = map[string]float64{
+		sourceURL: 0.3, sourceDescription: 0.15, sourceName: 0.15, sourceLocation: 0.1, sourcePinnedTweet: 0.05,
+	}
+)
+
+// handleCandidate is a Fediverse handle found in a Twitter profile.
+type handleCandidate struct {
+	Handle     string   `json:"handle"`
+	URL        string   `json:"url"`
+	Confidence float64  `json:"confidence"`
+	Sources    []string `json:"sources"`
+
+	handle fediHandle
+}
+
+// profileText is a piece of the Twitter profile, with t.co links expanded.
+type profileText struct {
+	source string
+	text   string
+}
+
+// Profile returns what we know about a Twitter user as JSON, including the
+// Fediverse handles found in their profile, best first, and whether the
+// best or the requested handle links back.
+func Profile(w http.ResponseWriter, r *http.Request) {
+	serve("profile", serveProfile)(w, r)
+}
+
+func serveProfile(w http.ResponseWriter, r *http.Request) {
+	if configErr != nil {
+		writeError(w, r, errMisconfigured(configErr))
+		return
+	}
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		writeError(w, r, errMissingUsername())
+		return
+	}
+	if err := checkOptOut(username); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	usr, err := lookupUser(r.Context(), username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if usr.Protected {
+		writeError(w, r, errUserProtected(username))
+		return
+	}
+	candidates := profileHandles(r.Context(), usr)
+	profile := map[string]interface{}{
+		"username": usr.ScreenName,
+		"name":     usr.Name,
+		"avatar":   originalAvatarURL(usr),
+		"handles":  candidates,
+	}
+	//verify the handle asked about, or else the best one
+	var h fediHandle
+	if v := r.URL.Query().Get("handle"); v != "" {
+		if h, err = parseHandle(v); err != nil {
+			writeError(w, r, errInvalidOption("handle", "must be of the form user@instance"))
+			return
+		}
+	} else if len(candidates) > 0 {
+		h = candidates[0].handle
+	}
+	if h != (fediHandle{}) {
+		v, err := verifyHandle(r.Context(), usr, h, candidates)
+		if r.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			//the handles are still worth having without the check
+			loggerFrom(r.Context()).Warn("verifying handle failed", errorAttrs(err)...)
+		}
+		profile["verification"] = v
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// profileHandles finds the Fediverse handles in the profile of usr,
+// including its pinned tweet, best first.
+func profileHandles(ctx context.Context, usr *twitter.User) []handleCandidate {
+	texts := userTexts(usr)
+	pinned, err := pinnedTweet(ctx, usr.IDStr)
+	if err != nil {
+		//v2 access is a bonus, the profile itself is what matters
+		loggerFrom(ctx).Debug("pinned tweet unavailable", errorAttrs(err)...)
+	} else if pinned != "" {
+		texts = append(texts, profileText{sourcePinnedTweet, pinned})
+	}
+	return findHandles(texts)
+}
+
+// userTexts returns the profile fields of usr worth scanning for handles.
+func userTexts(usr *twitter.User) []profileText {
+	description, website := usr.Description, usr.URL
+	if e := usr.Entities; e != nil {
+		description = expandURLs(description, e.Description.Urls)
+		website = expandURLs(website, e.URL.Urls)
+	}
+	return []profileText{
+		{sourceName, usr.Name},
+		{sourceDescription, description},
+		{sourceLocation, usr.Location},
+		{sourceURL, website},
+	}
+}
+
+// expandURLs replaces t.co links in text with the URLs they point at.
+func expandURLs(text string, urls []twitter.URLEntity) string {
+	for _, u := range urls {
+		if u.URL != "" && u.ExpandedURL != "" {
+			text = strings.ReplaceAll(text, u.URL, u.ExpandedURL)
+		}
+	}
+	return text
+}
+
+// findHandles extracts the handles mentioned in texts. Every mention adds
+// to the confidence of its handle, so a handle that is both in the bio and
+// the website field ranks above one mentioned once.
+func findHandles(texts []profileText) []handleCandidate {
+	byHandle := map[string]*handleCandidate{}
+	var order []string
+	mention := func(h fediHandle, form, source string) {
+		key := strings.ToLower(h.String())
+		c, ok := byHandle[key]
+		if !ok {
+			c = &handleCandidate{handle: h, Handle: h.String(), URL: h.URL()}
+			byHandle[key] = c
+			order = append(order, key)
+		}
+		//noisy-or: each mention is independent evidence
+		p := math.Min(formWeight[form]+sourceWeight[source], 0.95)
+		c.Confidence = 1 - (1-c.Confidence)*(1-p)
+		if !slices.Contains(c.Sources, source) {
+			c.Sources = append(c.Sources, source)
+		}
+	}
+
+	for _, t := range texts {
+		//URLs first, then blank them so their @user@host part isn't counted twice
+		text := profileURL.ReplaceAllStringFunc(t.text, func(m string) string {
+			sub := profileURL.FindStringSubmatch(m)
+			host, user, remote := strings.ToLower(sub[1]), sub[2], strings.ToLower(sub[3])
+			if remote != "" {
+				host = remote
+			}
+			if nonFediHosts[strings.ToLower(sub[1])] {
+				return m
+			}
+			if h, err := parseHandle(strings.TrimRight(user, ".-") + "@" + host); err == nil {
+				mention(h, "url", t.source)
+			}
+			return " "
+		})
+		for _, sub := range handleText.FindAllStringSubmatch(text, -1) {
+			at, user, host := sub[2], strings.TrimRight(sub[3], ".-"), strings.ToLower(sub[4])
+			if at == "" && mailHosts[host] {
+				continue
+			}
+			form := "bare"
+			if at != "" {
+				form = "at"
+			}
+			if h, err := parseHandle(user + "@" + host); err == nil {
+				mention(h, form, t.source)
+			}
+		}
+	}
+
+	candidates := make([]handleCandidate, 0, len(order))
+	for _, key := range order {
+		c := byHandle[key]
+		c.Confidence = math.Round(c.Confidence*100) / 100
+		candidates = append(candidates, *c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates
+}
+
+// pinnedTweet returns the text of the user's pinned tweet with its links
+// expanded, or "" without one. It needs the v2 API, go-twitter only speaks
+// v1.1.
+func pinnedTweet(ctx context.Context, userID string) (string, error) {
+	if userID == "" {
+		return "", nil
+	}
+	pctx, st := startStage(ctx, stagePinnedTweet)
+	pctx, cancel := context.WithTimeout(pctx, lookupTimeout)
+	defer cancel()
+	var body struct {
+		Includes struct {
+			Tweets []struct {
+				Text     string `json:"text"`
+				Entities struct {
+					URLs []twitter.URLEntity `json:"urls"`
+				} `json:"entities"`
+			} `json:"tweets"`
+		} `json:"includes"`
+	}
+	u := twitterAPIBase + "/2/users/" + url.PathEscape(userID) + "?" + url.Values{
+		"expansions":   {"pinned_tweet_id"},
+		"tweet.fields": {"entities"},
+	}.Encode()
+	_, err := twitterPool.doHTTP(pctx, endpointUserByID, func(client *http.Client) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(pctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp, fmt.Errorf("pinned tweet: unexpected status %s", resp.Status)
+		}
+		return resp, json.NewDecoder(resp.Body).Decode(&body)
+	})
+	st.end(err)
+	if err != nil || len(body.Includes.Tweets) == 0 {
+		return "", err
+	}
+	t := body.Includes.Tweets[0]
+	return expandURLs(t.Text, t.Entities.URLs), nil
+}
@@ -0,0 +1,84 @@
+package avatar
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindHandlesRanking(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []profileText
+		want  []string //handles, best first
+	}{
+		{name: "nothing", texts: []profileText{{sourceDescription, "just vibes"}}, want: []string{}},
+		{
+			name:  "at handle in the bio",
+			texts: []profileText{{sourceDescription, "find me at @jack@mastodon.social"}},
+			want:  []string{"jack@mastodon.social"},
+		},
+		{
+			name: "website beats bio",
+			texts: []profileText{
+				{sourceDescription, "also @alt@fosstodon.org"},
+				{sourceURL, "https://mastodon.social/@jack"},
+			},
+			want: []string{"jack@mastodon.social", "alt@fosstodon.org"},
+		},
+		{
+			name: "repeated mentions add up",
+			texts: []profileText{
+				{sourceName, "Jack @jack@mastodon.social"},
+				{sourceDescription, "old: @jack@octodon.social, now @jack@mastodon.social"},
+				{sourceLocation, "@jack@mastodon.social"},
+			},
+			want: []string{"jack@mastodon.social", "jack@octodon.social"},
+		},
+		{
+			name: "at form beats bare form",
+			texts: []profileText{
+				{sourceDescription, "jack@hachyderm.io or @jack@mastodon.social"},
+			},
+			want: []string{"jack@mastodon.social", "jack@hachyderm.io"},
+		},
+		{
+			name:  "mail addresses are skipped",
+			texts: []profileText{{sourceDescription, "mail jack@gmail.com"}},
+			want:  []string{},
+		},
+		{
+			name:  "non-Fediverse profile URLs are skipped",
+			texts: []profileText{{sourceURL, "https://medium.com/@jack"}},
+			want:  []string{},
+		},
+		{
+			name:  "remote account URL",
+			texts: []profileText{{sourceURL, "https://mastodon.social/@jack@fosstodon.org"}},
+			want:  []string{"jack@fosstodon.org"},
+		},
+		{
+			name: "case-insensitive handles merge",
+			texts: []profileText{
+				{sourceDescription, "@Jack@Mastodon.social"},
+				{sourceURL, "https://mastodon.social/@jack"},
+				{sourcePinnedTweet, "@other@fosstodon.org"},
+			},
+			want: []string{"Jack@mastodon.social", "other@fosstodon.org"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := findHandles(tt.texts)
+			got := []string{}
+			for i, c := range candidates {
+				got = append(got, c.Handle)
+				if i > 0 && c.Confidence > candidates[i-1].Confidence {
+					t.Errorf("%s (%v) ranked below %s (%v)", c.Handle, c.Confidence, candidates[i-1].Handle, candidates[i-1].Confidence)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("findHandles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package avatar
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Healthz reports that the process is up and serving requests.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether the service can render avatars: the config loaded,
+// an OAuth2 token can be obtained for at least one credential and the badge
+// asset decodes.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"config":        "ok",
+		"twitter_token": "ok",
+		"badge":         "ok",
+	}
+	ready := true
+	fail := func(check string, err error) {
+		checks[check] = err.Error()
+		ready = false
+	}
+
+	if configErr != nil {
+		fail("config", configErr)
+		fail("twitter_token", errors.New("not attempted"))
+	} else if err := twitterPool.checkToken(); err != nil {
+		fail("twitter_token", err)
+	}
+	if _, err := decodeBadge(); err != nil {
+		fail("badge", err)
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
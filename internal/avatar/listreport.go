@@ -0,0 +1,319 @@
+package avatar
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Migration status of a list member.
+const (
+	memberHandleAndBadge = "handle_and_badge"
+	memberHandle         = "handle"
+	memberBadge          = "badge"
+	memberNeither        = "neither"
+)
+
+const (
+	listPageSize         = 5000
+	avatarCheckWorkers   = 8
+	listReportCacheBytes = 16 << 20
+)
+
+var (
+	//recent reports as JSON, so the JSON, CSV and chart of a list are one job
+	listReports    *renderCache
+	maxListMembers int
+)
+
+// listReport is how far the members of a Twitter List have moved to the
+// Fediverse.
+type listReport struct {
+	ListID      string       `json:"list_id"`
+	Name        string       `json:"name"`
+	Owner       string       `json:"owner,omitempty"`
+	Members     int          `json:"members"`
+	Checked     int          `json:"checked"`
+	Truncated   bool         `json:"truncated,omitempty"`
+	Counts      listCounts   `json:"counts"`
+	Accounts    []listMember `json:"accounts"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+type listCounts struct {
+	HandleAndBadge int `json:"handle_and_badge"`
+	Handle         int `json:"handle"`
+	Badge          int `json:"badge"`
+	Neither        int `json:"neither"`
+}
+
+type listMember struct {
+	Username   string  `json:"username"`
+	Name       string  `json:"name"`
+	Handle     string  `json:"handle,omitempty"`
+	Badge      bool    `json:"badge"`
+	BadgeScore float64 `json:"badge_score"`
+	//AvatarChecked is false when the avatar could not be fetched
+	AvatarChecked bool   `json:"avatar_checked"`
+	Status        string `json:"status"`
+}
+
+// ListReport reports which members of the Twitter List in the id query
+// parameter have a Fediverse handle in their bio, which show the badge, and
+// which neither. format selects json (the default), csv or png, a chart.
+func ListReport(w http.ResponseWriter, r *http.Request) {
+	serve("list_report", serveListReport)(w, r)
+}
+
+func serveListReport(w http.ResponseWriter, r *http.Request) {
+	if configErr != nil {
+		writeError(w, r, errMisconfigured(configErr))
+		return
+	}
+	q := r.URL.Query()
+	id := q.Get("id")
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		writeError(w, r, &apiError{Status: http.StatusBadRequest, Code: "missing_list_id", Message: "Pass the numeric ID of a Twitter List in the id query parameter."})
+		return
+	}
+	format := q.Get("format")
+	switch format {
+	case "", "json", "csv", "png":
+	default:
+		writeError(w, r, errInvalidOption("format", "must be json, csv or png"))
+		return
+	}
+
+	key := "list:" + id
+	body, err := func() ([]byte, error) {
+		if entry, ok := listReports.get(key); ok && listReports.fresh(entry) {
+			return entry.png, nil
+		}
+		return renders.do(r.Context(), key, func(ctx context.Context) ([]byte, error) {
+			report, err := buildListReport(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			body, err := json.Marshal(report)
+			if err != nil {
+				return nil, err
+			}
+			//only a fresh build restarts the report's TTL
+			listReports.put(key, body)
+			return body, nil
+		})
+	}()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	case "csv":
+		var report listReport
+		if err := json.Unmarshal(body, &report); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeListCSV(w, r, &report)
+	case "png":
+		var report listReport
+		if err := json.Unmarshal(body, &report); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		png, err := listChart(&report)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writePNG(w, r, png)
+	}
+}
+
+// buildListReport fetches the list and its members, and checks every
+// member's bio and avatar.
+func buildListReport(ctx context.Context, id string) (*listReport, error) {
+	listID, _ := strconv.ParseInt(id, 10, 64)
+	var list *twitter.List
+	err := lookupTwitter(ctx, endpointListsShow, func(client *twitter.Client) (resp *http.Response, err error) {
+		list, resp, err = client.Lists.Show(&twitter.ListsShowParams{ListID: listID})
+		return resp, err
+	})
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == "user_not_found" {
+		return nil, &apiError{
+			Status:  http.StatusNotFound,
+			Code:    "list_not_found",
+			Message: fmt.Sprintf("The list %s does not exist or is private.", id),
+			Err:     err,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := &listReport{ListID: id, Name: list.Name, Members: list.MemberCount, GeneratedAt: time.Now().UTC()}
+	if list.User != nil {
+		report.Owner = list.User.ScreenName
+	}
+
+	var users []twitter.User
+	skipStatus, withEntities := true, true
+	for cursor := int64(-1); cursor != 0 && len(users) < maxListMembers; {
+		var page *twitter.Members
+		err := lookupTwitter(ctx, endpointListMembers, func(client *twitter.Client) (resp *http.Response, err error) {
+			page, resp, err = client.Lists.Members(&twitter.ListsMembersParams{
+				ListID:          listID,
+				Count:           listPageSize,
+				Cursor:          cursor,
+				SkipStatus:      &skipStatus,
+				IncludeEntities: &withEntities,
+			})
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page.Users...)
+		cursor = page.NextCursor
+	}
+	if len(users) > maxListMembers {
+		users = users[:maxListMembers]
+	}
+	report.Truncated = len(users) < report.Members
+
+	badge, err := decodeBadge()
+	if err != nil {
+		return nil, errMisconfigured(err)
+	}
+	report.Accounts = make([]listMember, len(users))
+	sem := make(chan struct{}, avatarCheckWorkers)
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			report.Accounts[i] = checkListMember(ctx, &users[i], badge)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range report.Accounts {
+		report.Checked++
+		switch m.Status {
+		case memberHandleAndBadge:
+			report.Counts.HandleAndBadge++
+		case memberHandle:
+			report.Counts.Handle++
+		case memberBadge:
+			report.Counts.Badge++
+		default:
+			report.Counts.Neither++
+		}
+	}
+	return report, nil
+}
+
+// checkListMember looks for a handle in the profile of usr and for the
+// badge in its avatar.
+func checkListMember(ctx context.Context, usr *twitter.User, badge image.Image) listMember {
+	m := listMember{Username: usr.ScreenName, Name: usr.Name}
+	if candidates := findHandles(userTexts(usr)); len(candidates) > 0 {
+		m.Handle = candidates[0].Handle
+	}
+	//the 200px variant is plenty, detection works at 128px
+	avatarURL := strings.Replace(usr.ProfileImageURLHttps, "_normal", "_200x200", 1)
+	if match, ok := checkMemberAvatar(ctx, avatarURL, badge); ok {
+		m.AvatarChecked = true
+		m.BadgeScore, m.Badge = match.Confidence, match.Found
+	}
+
+	switch {
+	case m.Handle != "" && m.Badge:
+		m.Status = memberHandleAndBadge
+	case m.Handle != "":
+		m.Status = memberHandle
+	case m.Badge:
+		m.Status = memberBadge
+	default:
+		m.Status = memberNeither
+	}
+	return m
+}
+
+// checkMemberAvatar downloads the avatar at avatarURL behind the avatar
+// breaker, and looks for badge in it holding a render slot like any other
+// decode. It reports false when the avatar could not be checked.
+func checkMemberAvatar(ctx context.Context, avatarURL string, badge image.Image) (badgeMatch, bool) {
+	if err := avatarBreaker.allow(); err != nil {
+		return badgeMatch{}, false
+	}
+	dctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	body, err := downloadAvatar(dctx, upstreamClient, avatarURL)
+	cancel()
+	avatarBreaker.record(err)
+	if err != nil {
+		return badgeMatch{}, false
+	}
+	release, err := acquireRenderSlot(ctx)
+	if err != nil {
+		return badgeMatch{}, false
+	}
+	defer release()
+	img, err := decodeImage(ctx, body)
+	if err != nil {
+		return badgeMatch{}, false
+	}
+	return detectBadge(img, badge), true
+}
+
+// lookupTwitter runs an app-only call to endpoint behind the breaker and
+// with the lookup deadline, and maps its errors.
+func lookupTwitter(ctx context.Context, endpoint string, call func(*twitter.Client) (*http.Response, error)) error {
+	if err := twitterBreaker.allow(); err != nil {
+		return err
+	}
+	lctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	resp, err := twitterPool.do(lctx, endpoint, call)
+	if err != nil {
+		err = twitterError("", resp, err)
+	}
+	twitterBreaker.record(err)
+	return err
+}
+
+func writeListCSV(w http.ResponseWriter, r *http.Request, report *listReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="list_%s.csv"`, report.ListID))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"username", "name", "fediverse_handle", "badge", "badge_score", "status"})
+	for _, m := range report.Accounts {
+		score := ""
+		if m.AvatarChecked {
+			score = strconv.FormatFloat(m.BadgeScore, 'f', 2, 64)
+		}
+		cw.Write([]string{m.Username, m.Name, m.Handle, strconv.FormatBool(m.Badge), score, m.Status})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		loggerFrom(r.Context()).Warn("writing response failed", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package avatar
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckMemberAvatar(t *testing.T) {
+	badge, err := decodeBadge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		status      int
+		slotsTaken  bool
+		members     int
+		wantChecked bool
+		wantFetches int32
+	}{
+		{name: "badged avatar", status: http.StatusOK, members: 1, wantChecked: true, wantFetches: 1},
+		{name: "failing CDN opens the breaker", status: http.StatusInternalServerError, members: 10, wantFetches: 3},
+		{name: "no render slot", status: http.StatusOK, slotsTaken: true, members: 1, wantFetches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avatar := encodePNG(t, badgedAvatar(t, badge, color.RGBA{0x80, 0x80, 0x80, 0xff}))
+			var fetches int32
+			cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&fetches, 1)
+				w.WriteHeader(tt.status)
+				w.Write(avatar)
+			}))
+			defer cdn.Close()
+			conf := testConfig(t, cdn.URL)
+			conf.BreakerThreshold = 3
+			conf.MaxConcurrentRenders = 1
+			conf.RenderQueueTimeout = 10 * time.Millisecond
+			useConfig(t, conf)
+			if tt.slotsTaken {
+				renderSlots <- struct{}{}
+				defer func() { <-renderSlots }()
+			}
+
+			var match badgeMatch
+			var checked bool
+			for i := 0; i < tt.members; i++ {
+				match, checked = checkMemberAvatar(context.Background(), cdn.URL+"/avatar_200x200.png", badge)
+			}
+			if checked != tt.wantChecked {
+				t.Errorf("checked = %v, want %v", checked, tt.wantChecked)
+			}
+			if checked && !match.Found {
+				t.Errorf("badge not found, confidence %v", match.Confidence)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("%d avatar fetches, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
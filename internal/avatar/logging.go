@@ -0,0 +1,111 @@
+package avatar
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	//log a short keyed hash instead of the username
+	hashUsernames   bool
+	usernameHashKey []byte
+)
+
+type loggerKey struct{}
+
+// newLogger builds the process logger at the given level.
+func newLogger(level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: l})), nil
+}
+
+// loggerFrom returns the request scoped logger stored in ctx.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return logger
+}
+
+// withRequestID tags the request with an ID, echoed in the X-Request-ID
+// header and attached to every log line of the request, and logs the request
+// once it is served.
+func withRequestID(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		log := logger.With("request_id", id)
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, log))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		log.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start))
+	}
+}
+
+// validRequestID accepts short, printable IDs set by an upstream proxy.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logUser is the username as it should appear in logs.
+func logUser(username string) string {
+	if !hashUsernames {
+		return username
+	}
+	//keyed, so the short list of likely usernames can't be hashed to
+	//reverse the logs
+	mac := hmac.New(sha256.New, usernameHashKey)
+	mac.Write([]byte(strings.ToLower(username)))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// errorClass is the apiError code of err, for logs.
+func errorClass(err error) string {
+	var e *apiError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return "internal_error"
+}
+
+// errorAttrs describes err for logs. Upstream errors embed request URLs
+// containing the username, so their text is left out when usernames are hashed.
+func errorAttrs(err error) []any {
+	attrs := []any{"error_class", errorClass(err)}
+	if !hashUsernames {
+		attrs = append(attrs, "error", err)
+	}
+	return attrs
+}
@@ -0,0 +1,39 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadAvatarLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		wantCode string
+	}{
+		{name: "small", size: 1 << 10},
+		{name: "at the limit", size: maxAvatarBytes},
+		{name: "over the limit", size: maxAvatarBytes + 1, wantCode: "avatar_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(bytes.Repeat([]byte{1}, tt.size))
+			}))
+			defer srv.Close()
+			body, err := downloadAvatar(context.Background(), srv.Client(), srv.URL)
+			if err != nil && errorClass(err) != tt.wantCode || err == nil && tt.wantCode != "" {
+				t.Fatalf("downloadAvatar() = %v, want code %q", err, tt.wantCode)
+			}
+			if err == nil && len(body) != tt.size {
+				t.Errorf("downloaded %d bytes, want %d", len(body), tt.size)
+			}
+			if isUpstreamFailure(err) {
+				t.Error("an oversized avatar counts against the breaker")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package avatar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// hostPattern accepts plain DNS names, so user supplied instances can't point
+// us at IP addresses or odd ports.
+var hostPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*\.[a-z]{2,}$`)
+
+// fediHandle is a Fediverse account address, user@instance.
+type fediHandle struct {
+	User     string
+	Instance string
+}
+
+func (h fediHandle) String() string {
+	return h.User + "@" + h.Instance
+}
+
+// URL is the address of the profile of h, as Mastodon shows it.
+func (h fediHandle) URL() string {
+	return "https://" + h.Instance + "/@" + h.User
+}
+
+// parseHandle parses "@user@instance" or "user@instance".
+func parseHandle(s string) (fediHandle, error) {
+	user, instance, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(s), "@"), "@")
+	if !ok || user == "" || strings.ContainsAny(user, "/?#@ ") || !hostPattern.MatchString(instance) {
+		return fediHandle{}, fmt.Errorf("%q is not a handle of the form user@instance", s)
+	}
+	return fediHandle{User: user, Instance: strings.ToLower(instance)}, nil
+}
+
+// mastodonAccount is the part of a Mastodon account entity we use.
+type mastodonAccount struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Acct     string `json:"acct"`
+	URL      string `json:"url"`
+	Note     string `json:"note"`
+	Avatar   string `json:"avatar"`
+	//AvatarStatic is the avatar, or its first frame when animated
+	AvatarStatic string `json:"avatar_static"`
+	Fields       []struct {
+		Name       string  `json:"name"`
+		Value      string  `json:"value"`
+		VerifiedAt *string `json:"verified_at"`
+	} `json:"fields"`
+}
+
+// lookupMastodonAccount fetches the public account for h from its instance.
+func lookupMastodonAccount(ctx context.Context, h fediHandle) (*mastodonAccount, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     h.Instance,
+		Path:     "/api/v1/accounts/lookup",
+		RawQuery: url.Values{"acct": {h.User}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := fediverseClient.Do(req)
+	if err != nil {
+		return nil, upstreamError(err, errMastodonUnavailable)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &apiError{
+			Status:  http.StatusNotFound,
+			Code:    "fediverse_account_not_found",
+			Message: fmt.Sprintf("The account %s does not exist.", h),
+		}
+	case resp.StatusCode != http.StatusOK:
+		return nil, errMastodonUnavailable(fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	acct := &mastodonAccount{}
+	if err := json.NewDecoder(resp.Body).Decode(acct); err != nil {
+		return nil, errMastodonUnavailable(err)
+	}
+	return acct, nil
+}
+
+func errMastodonUnavailable(err error) error {
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Code:    "mastodon_unavailable",
+		Message: "The Mastodon instance could not be reached.",
+		Err:     err,
+	}
+}
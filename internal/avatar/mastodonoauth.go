@@ -0,0 +1,402 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	mastodonStateCookie = "mastodon_oauth"
+	mastodonScopes      = "read:accounts write:accounts"
+)
+
+// appRegistrationTimeout bounds loading or registering the app of an
+// instance.
+const appRegistrationTimeout = 10 * time.Second
+
+// mastodonApps caches the app registered on each instance, backed by the
+// token store so restarts don't register new ones. Concurrent sign ins on an
+// instance share one registration.
+var mastodonApps = struct {
+	sync.Mutex
+	byInstance map[string]*mastodonApp
+	pending    map[string]*appRegistration
+}{byInstance: map[string]*mastodonApp{}, pending: map[string]*appRegistration{}}
+
+// appRegistration is a registration in progress.
+type appRegistration struct {
+	done chan struct{}
+	app  *mastodonApp
+	err  error
+}
+
+// mastodonApp is the OAuth client registered on an instance.
+type mastodonApp struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURI  string `json:"redirect_uri"`
+}
+
+// mastodonState is the OAuth state kept in a sealed cookie between the login
+// redirect and the callback.
+type mastodonState struct {
+	Instance string
+	State    string
+	Badge    string
+	BadgeURL string
+	Action   string
+	Expires  time.Time
+}
+
+func (s *mastodonState) expired() bool {
+	return time.Now().After(s.Expires)
+}
+
+// mastodonToken is a user's access token, as kept in the token store.
+type mastodonToken struct {
+	Instance    string
+	AccountID   string
+	Acct        string
+	AccessToken string
+}
+
+// MastodonLogin registers the app on the instance query parameter if needed
+// and redirects to it for authorization.
+func MastodonLogin(w http.ResponseWriter, r *http.Request) {
+	serve("mastodon_login", serveMastodonLogin)(w, r)
+}
+
+// MastodonCallback finishes the authorization, renders the badged avatar
+// and sets it as the account's avatar.
+func MastodonCallback(w http.ResponseWriter, r *http.Request) {
+	serve("mastodon_callback", serveMastodonCallback)(w, r)
+}
+
+func serveMastodonLogin(w http.ResponseWriter, r *http.Request) {
+	if err := applyEnabled(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	instance := strings.ToLower(strings.TrimSpace(q.Get("instance")))
+	if !hostPattern.MatchString(instance) {
+		writeError(w, r, &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_instance",
+			Message: "The instance must be a host name, like mastodon.social.",
+		})
+		return
+	}
+	action, err := parseAction(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	//fail before the round trip to the instance rather than in the callback
+	if _, err := loadBadge(r.Context(), q.Get("badge"), q.Get("badge_url")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	app, err := registerMastodonApp(r.Context(), instance)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st := mastodonState{
+		Instance: instance,
+		State:    base64.RawURLEncoding.EncodeToString(nonce),
+		Badge:    q.Get("badge"),
+		BadgeURL: q.Get("badge_url"),
+		Action:   action,
+		Expires:  time.Now().Add(oauthStateTTL),
+	}
+	sealed, err := secrets.seal(mastodonStateCookie, st)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setStateCookie(w, mastodonStateCookie, "/api/fediverse", sealed)
+	http.Redirect(w, r, app.oauth(instance).AuthCodeURL(st.State), http.StatusFound)
+}
+
+func serveMastodonCallback(w http.ResponseWriter, r *http.Request) {
+	if err := applyEnabled(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		writePage(w, http.StatusForbidden, "Nothing changed", "You did not authorize the app, your avatar was left alone.")
+		return
+	}
+	var st mastodonState
+	if err := readStateCookie(r, mastodonStateCookie, &st); err != nil || st.State != q.Get("state") || q.Get("code") == "" {
+		writeError(w, r, errOAuthState(err))
+		return
+	}
+	clearStateCookie(w, mastodonStateCookie, "/api/fediverse")
+
+	app, err := registerMastodonApp(r.Context(), st.Instance)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, fediverseClient)
+	token, err := app.oauth(st.Instance).Exchange(ctx, q.Get("code"))
+	if err != nil {
+		writeError(w, r, errMastodonOAuth(err))
+		return
+	}
+	api := &mastodonUserAPI{instance: st.Instance, token: token.AccessToken}
+	acct, err := api.verifyCredentials(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	handle := fediHandle{User: acct.Username, Instance: st.Instance}
+	stored := mastodonToken{Instance: st.Instance, AccountID: acct.ID, Acct: handle.String(), AccessToken: token.AccessToken}
+	if err := tokens.put("mastodon:"+st.Instance+":"+acct.ID, stored); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if st.Action == actionRevert {
+		revertMastodonAvatar(w, r, api, acct, handle)
+		return
+	}
+	if err := backupAvatar(r.Context(), "mastodon", st.Instance+":"+acct.ID, handle.String(), acct.Avatar); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	badge, err := loadBadge(r.Context(), st.Badge, st.BadgeURL)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	key := "mastodon:" + handle.String() + "|" + st.Badge + "|" + st.BadgeURL
+	png, err := renders.do(r.Context(), key, func(ctx context.Context) ([]byte, error) {
+		return renderMastodonAvatar(ctx, acct.AvatarStatic, applyStyle(badge))
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := api.updateAvatar(r.Context(), png, "avatar.png"); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loggerFrom(r.Context()).Info("applied avatar", "platform", "mastodon", "username", logUser(handle.String()))
+	writePage(w, http.StatusOK, "Done", fmt.Sprintf("The badged avatar is now the avatar of @%s.", handle))
+}
+
+// applyStyle is the style the Mastodon callback renders with. Like the
+// Twitter flow it leaves an avatar that already shows the badge as it is,
+// so applying twice doesn't stamp a second badge.
+func applyStyle(badge image.Image) style {
+	return style{Badge: badge, SkipIfBadged: true}
+}
+
+// revertMastodonAvatar puts the backed up original avatar back.
+func revertMastodonAvatar(w http.ResponseWriter, r *http.Request, api *mastodonUserAPI, acct *mastodonAccount, handle fediHandle) {
+	id := handle.Instance + ":" + acct.ID
+	backup, err := loadBackup("mastodon", id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := api.updateAvatar(r.Context(), backup.Image, "avatar"+imageExt(backup.ContentType)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := dropBackup("mastodon", id); err != nil {
+		loggerFrom(r.Context()).Warn("dropping avatar backup failed", "error", err)
+	}
+	loggerFrom(r.Context()).Info("reverted avatar", "platform", "mastodon", "username", logUser(handle.String()))
+	writePage(w, http.StatusOK, "Done", fmt.Sprintf("@%s has its original avatar back.", handle))
+}
+
+// registerMastodonApp returns the app registered on instance, registering
+// it through /api/v1/apps the first time. The registration runs outside the
+// lock, so a slow instance only holds up sign ins on that instance.
+func registerMastodonApp(ctx context.Context, instance string) (*mastodonApp, error) {
+	redirectURI := strings.TrimSuffix(publicURL, "/") + "/api/fediverse/callback"
+	mastodonApps.Lock()
+	if app, ok := mastodonApps.byInstance[instance]; ok && app.RedirectURI == redirectURI {
+		mastodonApps.Unlock()
+		return app, nil
+	}
+	reg, ok := mastodonApps.pending[instance]
+	if !ok {
+		reg = &appRegistration{done: make(chan struct{})}
+		mastodonApps.pending[instance] = reg
+		//keep going if the caller that started it gives up, others may wait
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), appRegistrationTimeout)
+		go func() {
+			defer cancel()
+			reg.app, reg.err = loadOrRegisterApp(rctx, instance, redirectURI)
+			mastodonApps.Lock()
+			delete(mastodonApps.pending, instance)
+			if reg.err == nil {
+				mastodonApps.byInstance[instance] = reg.app
+			}
+			mastodonApps.Unlock()
+			close(reg.done)
+		}()
+	}
+	mastodonApps.Unlock()
+
+	select {
+	case <-reg.done:
+		return reg.app, reg.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loadOrRegisterApp loads the app of instance from the token store, or
+// registers a new one when there is none for redirectURI.
+func loadOrRegisterApp(ctx context.Context, instance, redirectURI string) (*mastodonApp, error) {
+	app := &mastodonApp{}
+	err := tokens.get("mastodon-app:"+instance, app)
+	if err == nil && app.RedirectURI == redirectURI {
+		return app, nil
+	}
+	if err != nil && err != errNoToken {
+		return nil, err
+	}
+
+	form := url.Values{
+		"client_name":   {"Mastodon in Twitter avatar"},
+		"redirect_uris": {redirectURI},
+		"scopes":        {mastodonScopes},
+		"website":       {publicURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+instance+"/api/v1/apps", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	app = &mastodonApp{}
+	if err := doMastodon(req, app); err != nil {
+		return nil, err
+	}
+	if app.ClientID == "" || app.ClientSecret == "" {
+		return nil, errMastodonOAuth(fmt.Errorf("%s did not return client credentials", instance))
+	}
+	app.RedirectURI = redirectURI
+	if err := tokens.put("mastodon-app:"+instance, app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (a *mastodonApp) oauth(instance string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     a.ClientID,
+		ClientSecret: a.ClientSecret,
+		RedirectURL:  a.RedirectURI,
+		Scopes:       strings.Fields(mastodonScopes),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://" + instance + "/oauth/authorize",
+			TokenURL:  "https://" + instance + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// mastodonUserAPI calls a Mastodon instance on behalf of a signed in user.
+type mastodonUserAPI struct {
+	instance string
+	token    string
+}
+
+func (a *mastodonUserAPI) verifyCredentials(ctx context.Context) (*mastodonAccount, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+a.instance+"/api/v1/accounts/verify_credentials", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	acct := &mastodonAccount{}
+	if err := doMastodon(req, acct); err != nil {
+		return nil, err
+	}
+	return acct, nil
+}
+
+func (a *mastodonUserAPI) updateAvatar(ctx context.Context, img []byte, filename string) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("avatar", filename)
+	if err != nil {
+		return err
+	}
+	part.Write(img)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "https://"+a.instance+"/api/v1/accounts/update_credentials", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return doMastodon(req, nil)
+}
+
+// doMastodon sends req to an instance and decodes a successful JSON
+// response into v, if set.
+func doMastodon(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := fediverseClient.Do(req)
+	if err != nil {
+		return upstreamError(err, errMastodonUnavailable)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &apiError{
+			Status:  http.StatusUnauthorized,
+			Code:    "mastodon_token_revoked",
+			Message: "The instance no longer accepts the sign in, please sign in again.",
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &apiError{
+			Status:  http.StatusTooManyRequests,
+			Code:    "rate_limited",
+			Message: "The instance is rate limiting us, try again later.",
+		}
+	case resp.StatusCode != http.StatusOK:
+		return errMastodonUnavailable(fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func errMastodonOAuth(err error) error {
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Code:    "mastodon_oauth_failed",
+		Message: "Signing in with Mastodon failed.",
+		Err:     err,
+	}
+}
@@ -0,0 +1,45 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyStyleTwice(t *testing.T) {
+	badge, err := decodeBadge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatar := encodePNG(t, flatImage(400, 400, color.RGBA{0x80, 0x80, 0x80, 0xff}))
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(avatar)
+	}))
+	defer cdn.Close()
+	useConfig(t, testConfig(t, cdn.URL))
+
+	once, err := renderAvatar(context.Background(), cdn.URL+"/avatar.png", applyStyle(badge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeImage(context.Background(), once)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := detectBadge(img, badge); !m.Found {
+		t.Fatalf("first apply: badge not found, confidence %v", m.Confidence)
+	}
+
+	//the second apply starts from the avatar the first one set
+	avatar = once
+	twice, err := renderAvatar(context.Background(), cdn.URL+"/avatar.png", applyStyle(badge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(twice, once) {
+		t.Error("second apply changed the badged avatar")
+	}
+}
@@ -0,0 +1,93 @@
+package avatar
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Render stages, as used for the stage label of stageDuration.
+const (
+	stageTwitterLookup  = "twitter_lookup"
+	stagePinnedTweet    = "pinned_tweet"
+	stageAvatarDownload = "avatar_download"
+	stageDecode         = "decode"
+	stageComposite      = "composite"
+	stageEncode         = "encode"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "avatar_http_requests_total",
+		Help: "HTTP requests by endpoint and status code.",
+	}, []string{"endpoint", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "avatar_http_request_duration_seconds",
+		Help:    "HTTP request latency by endpoint.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "avatar_stage_duration_seconds",
+		Help:    "Latency of the render stages: twitter_lookup, pinned_tweet, avatar_download, decode, composite and encode.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"stage"})
+
+	outputBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "avatar_output_bytes",
+		Help:    "Size of the rendered PNGs.",
+		Buckets: prometheus.ExponentialBuckets(16<<10, 2, 8),
+	})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "avatar_render_cache_requests_total",
+		Help: "Render cache lookups by result: hit, miss or stale.",
+	}, []string{"result"})
+
+	rateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "avatar_twitter_rate_limit_remaining",
+		Help: "Remaining calls in the current window, per credential and endpoint.",
+	}, []string{"credential", "endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, stageDuration, outputBytes, cacheRequests, rateLimitRemaining)
+}
+
+var metricsHandler = promhttp.Handler()
+
+// Metrics serves the Prometheus metrics.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// observeStage records how long a render stage took.
+func observeStage(stage string, d time.Duration) {
+	stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrument counts and times the requests served by h.
+func instrument(endpoint string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		requestsTotal.WithLabelValues(endpoint, strconv.Itoa(rec.status)).Inc()
+		requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,307 @@
+package avatar
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// renderOptions are the optional query parameters of Handler.
+type renderOptions struct {
+	//ShowHandle captions the avatar with the best Fediverse handle found
+	//in the profile
+	ShowHandle bool
+	//Handle is the Fediverse handle to use instead of the detected one
+	Handle fediHandle
+	//Verify switches to the verified badge when the Twitter profile and
+	//the handle link to each other
+	Verify bool
+	//Caption is text for the caption bar, it takes precedence over
+	//ShowHandle
+	Caption string
+	//Ring frames a round avatar with a ring of text, its Text defaults to
+	//a pointer to the handle
+	Ring *ringStyle
+	//Ribbon replaces the badge with a ribbon across a corner
+	Ribbon *ribbonStyle
+	//QR adds a QR code of the Fediverse profile
+	QR *qrStyle
+	//Badge names the badge to stamp, the Mastodon logo when empty
+	Badge string
+	//BadgeStyle outlines, shadows or recolors the badge
+	BadgeStyle badgeStyle
+}
+
+// parseRenderOptions reads the render options from the query.
+func parseRenderOptions(q url.Values) (renderOptions, error) {
+	var opts renderOptions
+	if v := q.Get("show_handle"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidOption("show_handle", "must be true or false")
+		}
+		opts.ShowHandle = b
+	}
+	if v := q.Get("verify"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidOption("verify", "must be true or false")
+		}
+		opts.Verify = b
+	}
+	if v := strings.TrimSpace(q.Get("caption")); v != "" {
+		if utf8.RuneCountInString(v) > maxCaptionLength || !utf8.ValidString(v) {
+			return opts, errInvalidOption("caption", fmt.Sprintf("must be valid text of at most %d characters", maxCaptionLength))
+		}
+		opts.Caption = v
+	}
+	if v := q.Get("ring"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidOption("ring", "must be true or false")
+		}
+		if b {
+			if opts.Ring, err = parseRing(q); err != nil {
+				return opts, err
+			}
+		}
+	}
+	if v := q.Get("ribbon"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidOption("ribbon", "must be true or false")
+		}
+		if b {
+			if opts.Ribbon, err = parseRibbon(q); err != nil {
+				return opts, err
+			}
+		}
+	}
+	switch v := q.Get("qr"); v {
+	case "", "false":
+	case "true", qrModeCorner, qrModeCard:
+		var err error
+		if opts.QR, err = parseQR(q); err != nil {
+			return opts, err
+		}
+		if v == qrModeCard {
+			opts.QR.Mode = qrModeCard
+		}
+	default:
+		return opts, errInvalidOption("qr", "must be corner, card or false")
+	}
+	switch v := q.Get("badge"); v {
+	case "", badgeMastodon:
+	case badgeTwitter:
+		opts.Badge = v
+	default:
+		return opts, errInvalidOption("badge", "must be mastodon or twitter")
+	}
+	switch v := q.Get("badge_outline"); v {
+	case "", "false":
+	case "true":
+		c := badgeLight
+		opts.BadgeStyle.Outline = &c
+	default:
+		c, ok := parseHexColor(v)
+		if !ok {
+			return opts, errInvalidOption("badge_outline", "must be true, false or a hex color such as ffffff")
+		}
+		opts.BadgeStyle.Outline = &c
+	}
+	if v := q.Get("badge_shadow"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidOption("badge_shadow", "must be true or false")
+		}
+		opts.BadgeStyle.Shadow = b
+	}
+	switch v := q.Get("badge_contrast"); v {
+	case "", "off":
+	case "auto":
+		opts.BadgeStyle.Auto = true
+	default:
+		return opts, errInvalidOption("badge_contrast", "must be auto or off")
+	}
+	if v := q.Get("handle"); v != "" {
+		h, err := parseHandle(v)
+		if err != nil {
+			return opts, errInvalidOption("handle", "must be of the form user@instance")
+		}
+		opts.Handle = h
+	}
+	return opts, nil
+}
+
+// key is appended to the cache key, so every set of options gets its own
+// render. The defaults add nothing.
+func (o renderOptions) key() string {
+	var parts []string
+	if o.ShowHandle {
+		parts = append(parts, "handle")
+	}
+	if o.Handle != (fediHandle{}) {
+		parts = append(parts, "as="+strings.ToLower(o.Handle.String()))
+	}
+	if o.Verify {
+		parts = append(parts, "verify")
+	}
+	if o.Caption != "" {
+		parts = append(parts, "caption="+strconv.Quote(o.Caption))
+	}
+	if rs := o.Ring; rs != nil {
+		parts = append(parts, fmt.Sprintf("ring=%q,%s,%s,%g,%g",
+			rs.Text, hexColor(rs.Color), hexColor(rs.TextColor), rs.Thickness, rs.Start))
+	}
+	if rb := o.Ribbon; rb != nil {
+		parts = append(parts, fmt.Sprintf("ribbon=%q,%s,%s,%s",
+			rb.Text, rb.Corner, hexColor(rb.Color), hexColor(rb.TextColor)))
+	}
+	if qs := o.QR; qs != nil {
+		parts = append(parts, fmt.Sprintf("qr=%s,%s,%s,%d,%d", qs.Mode, qs.Corner, qs.levelName(), qs.Quiet, qs.MinModule))
+	}
+	if o.Badge != "" {
+		parts = append(parts, "logo="+o.Badge)
+	}
+	if bs := o.BadgeStyle; bs != (badgeStyle{}) {
+		outline := ""
+		if bs.Outline != nil {
+			outline = hexColor(*bs.Outline)
+		}
+		parts = append(parts, fmt.Sprintf("badge=%s,%t,%t", outline, bs.Shadow, bs.Auto))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "|" + strings.Join(parts, "|")
+}
+
+// parseRing reads the ring_* parameters over the default ring.
+func parseRing(q url.Values) (*ringStyle, error) {
+	rs := defaultRing()
+	if v := strings.TrimSpace(q.Get("ring_text")); v != "" {
+		if utf8.RuneCountInString(v) > maxCaptionLength || !utf8.ValidString(v) {
+			return nil, errInvalidOption("ring_text", fmt.Sprintf("must be valid text of at most %d characters", maxCaptionLength))
+		}
+		rs.Text = v
+	}
+	for name, c := range map[string]*color.NRGBA{"ring_color": &rs.Color, "ring_text_color": &rs.TextColor} {
+		if v := q.Get(name); v != "" {
+			parsed, ok := parseHexColor(v)
+			if !ok {
+				return nil, errInvalidOption(name, "must be a hex color such as 6364ff or 6364ff80")
+			}
+			*c = parsed
+		}
+	}
+	if v := q.Get("ring_thickness"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minRingThickness || n > maxRingThickness {
+			return nil, errInvalidOption("ring_thickness", fmt.Sprintf("must be a percentage between %d and %d", minRingThickness, maxRingThickness))
+		}
+		rs.Thickness = float64(n) / 100
+	}
+	if v := q.Get("ring_start"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errInvalidOption("ring_start", "must be an angle in degrees")
+		}
+		rs.Start = math.Mod(math.Mod(f, 360)+360, 360)
+	}
+	return rs, nil
+}
+
+// parseRibbon reads the ribbon_* parameters over the default ribbon.
+func parseRibbon(q url.Values) (*ribbonStyle, error) {
+	rb := defaultRibbon()
+	if v := strings.TrimSpace(q.Get("ribbon_text")); v != "" {
+		if utf8.RuneCountInString(v) > maxCaptionLength || !utf8.ValidString(v) {
+			return nil, errInvalidOption("ribbon_text", fmt.Sprintf("must be valid text of at most %d characters", maxCaptionLength))
+		}
+		rb.Text = v
+	}
+	switch v := q.Get("ribbon_corner"); v {
+	case "":
+	case cornerTopLeft, cornerTopRight, cornerBottomLeft, cornerBottomRight:
+		rb.Corner = v
+	default:
+		return nil, errInvalidOption("ribbon_corner", "must be top_left, top_right, bottom_left or bottom_right")
+	}
+	for name, c := range map[string]*color.NRGBA{"ribbon_color": &rb.Color, "ribbon_text_color": &rb.TextColor} {
+		if v := q.Get(name); v != "" {
+			parsed, ok := parseHexColor(v)
+			if !ok {
+				return nil, errInvalidOption(name, "must be a hex color such as 6364ff or 6364ff80")
+			}
+			*c = parsed
+		}
+	}
+	return rb, nil
+}
+
+// parseQR reads the qr_* parameters over the default QR code.
+func parseQR(q url.Values) (*qrStyle, error) {
+	qs := defaultQR()
+	switch v := q.Get("qr_corner"); v {
+	case "":
+	case cornerTopLeft, cornerTopRight, cornerBottomLeft, cornerBottomRight:
+		qs.Corner = v
+	default:
+		return nil, errInvalidOption("qr_corner", "must be top_left, top_right, bottom_left or bottom_right")
+	}
+	if v := q.Get("qr_level"); v != "" {
+		l, ok := qrLevels[strings.ToUpper(v)]
+		if !ok {
+			return nil, errInvalidOption("qr_level", "must be L, M, Q or H")
+		}
+		qs.Level = l
+	}
+	if v := q.Get("qr_quiet"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxQRQuiet {
+			return nil, errInvalidOption("qr_quiet", fmt.Sprintf("must be between 0 and %d modules", maxQRQuiet))
+		}
+		qs.Quiet = n
+	}
+	if v := q.Get("qr_min_module"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRModule || n > maxQRModule {
+			return nil, errInvalidOption("qr_min_module", fmt.Sprintf("must be between %d and %d pixels", minQRModule, maxQRModule))
+		}
+		qs.MinModule = n
+	}
+	return qs, nil
+}
+
+// parseHexColor parses RRGGBB or RRGGBBAA, with or without a leading #.
+func parseHexColor(s string) (color.NRGBA, bool) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, false
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func errInvalidOption(name, problem string) error {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    "invalid_option",
+		Message: "The " + name + " parameter " + problem + ".",
+	}
+}
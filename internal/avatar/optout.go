@@ -0,0 +1,267 @@
+package avatar
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	optOuts      optOutStore
+	optOutSecret []byte
+)
+
+// optOutStore holds the usernames that must not be rendered.
+type optOutStore interface {
+	contains(username string) (bool, error)
+	add(username string) error
+}
+
+// optOutFile is an optOutStore backed by a file with one username per line.
+// Edits to the file are picked up within reloadEvery.
+type optOutFile struct {
+	path        string
+	reloadEvery time.Duration
+
+	mu      sync.RWMutex
+	names   map[string]bool
+	modTime time.Time
+	checked time.Time
+}
+
+func newOptOutFile(path string, reloadEvery time.Duration) (*optOutFile, error) {
+	f := &optOutFile{path: path, reloadEvery: reloadEvery}
+	if err := f.reload(); err != nil {
+		return nil, fmt.Errorf("config: OptOutFile: %w", err)
+	}
+	return f, nil
+}
+
+// reload reads the file again if it changed since the last read.
+func (f *optOutFile) reload() error {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.mu.Lock()
+		f.names, f.checked = map[string]bool{}, time.Now()
+		f.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.mu.RLock()
+	unchanged := f.names != nil && info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		f.mu.Lock()
+		f.checked = time.Now()
+		f.mu.Unlock()
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	names := map[string]bool{}
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			names[normalizeUsername(line)] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.names, f.modTime, f.checked = names, info.ModTime(), time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *optOutFile) contains(username string) (bool, error) {
+	f.mu.RLock()
+	stale := time.Since(f.checked) > f.reloadEvery
+	f.mu.RUnlock()
+	if stale {
+		if err := f.reload(); err != nil {
+			return false, err
+		}
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.names[normalizeUsername(username)], nil
+}
+
+func (f *optOutFile) add(username string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := normalizeUsername(username)
+	if f.names[name] {
+		return nil
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, name); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	f.names[name] = true
+	return nil
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// checkOptOut fails with a 451 if the user opted out.
+func checkOptOut(username string) error {
+	if optOuts == nil {
+		return nil
+	}
+	blocked, err := optOuts.contains(username)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return &apiError{
+			Status:  http.StatusUnavailableForLegalReasons,
+			Code:    "opted_out",
+			Message: fmt.Sprintf("@%s has opted out of badged avatars.", username),
+		}
+	}
+	return nil
+}
+
+// optOutCode is the code a user puts in their profile to prove they own it.
+func optOutCode(username string) string {
+	mac := hmac.New(sha256.New, optOutSecret)
+	mac.Write([]byte("optout:" + normalizeUsername(username)))
+	sum := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(mac.Sum(nil))
+	return "optout-" + strings.ToLower(sum[:10])
+}
+
+// OptOut is the self-service opt-out flow. GET returns the code to put in
+// the Twitter bio, or in the bio of a Mastodon account the Twitter profile
+// links to. POST checks for the code and adds the user to the opt-out list.
+func OptOut(w http.ResponseWriter, r *http.Request) {
+	serve("optout", serveOptOut)(w, r)
+}
+
+func serveOptOut(w http.ResponseWriter, r *http.Request) {
+	if configErr != nil {
+		writeError(w, r, errMisconfigured(configErr))
+		return
+	}
+	if optOuts == nil || len(optOutSecret) == 0 {
+		writeError(w, r, &apiError{Status: http.StatusNotFound, Code: "optout_disabled", Message: "Self-service opt-out is not enabled."})
+		return
+	}
+	username := normalizeUsername(r.URL.Query().Get("username"))
+	if username == "" {
+		writeError(w, r, errMissingUsername())
+		return
+	}
+	code := optOutCode(username)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"username": username,
+			"code":     code,
+			"instructions": "Add the code to your Twitter bio, or to the bio of the Mastodon account " +
+				"your Twitter profile links to, then POST to this URL (add &handle=user@instance for Mastodon). " +
+				"You can remove the code afterwards.",
+		})
+	case http.MethodPost:
+		if err := verifyOptOut(r.Context(), username, r.URL.Query().Get("handle"), code); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := optOuts.add(username); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		loggerFrom(r.Context()).Info("user opted out", "username", logUser(username))
+		writeJSON(w, http.StatusOK, map[string]string{"username": username, "status": "opted_out"})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, r, &apiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Use GET or POST."})
+	}
+}
+
+// verifyOptOut checks that code is in the Twitter profile of username or, if
+// handle is set, in the Mastodon profile that the Twitter profile names.
+func verifyOptOut(ctx context.Context, username, handle, code string) error {
+	usr, err := lookupUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	twitterText := strings.ToLower(strings.Join([]string{usr.Name, usr.Description, usr.Location, usr.URL}, " "))
+	if handle == "" {
+		if strings.Contains(twitterText, code) {
+			return nil
+		}
+		return errCodeNotFound("your Twitter profile")
+	}
+
+	h, err := parseHandle(handle)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_handle", Message: err.Error()}
+	}
+	if !slices.ContainsFunc(profileHandles(ctx, usr), func(c handleCandidate) bool {
+		return strings.EqualFold(c.Handle, h.String())
+	}) {
+		return &apiError{
+			Status:  http.StatusForbidden,
+			Code:    "handle_not_linked",
+			Message: fmt.Sprintf("Your Twitter profile must mention %s.", h),
+		}
+	}
+	acct, err := lookupMastodonAccount(ctx, h)
+	if err != nil {
+		return err
+	}
+	mastodonText := acct.Note
+	for _, f := range acct.Fields {
+		mastodonText += " " + f.Value
+	}
+	if strings.Contains(strings.ToLower(mastodonText), code) {
+		return nil
+	}
+	return errCodeNotFound("the Mastodon profile of " + h.String())
+}
+
+func errCodeNotFound(where string) error {
+	return &apiError{
+		Status:  http.StatusForbidden,
+		Code:    "code_not_found",
+		Message: fmt.Sprintf("The opt-out code was not found in %s.", where),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
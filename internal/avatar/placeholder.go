@@ -0,0 +1,68 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+)
+
+var (
+	placeholderOnce sync.Once
+	placeholderPNG  []byte
+	placeholderErr  error
+)
+
+// placeholder returns a generic badged silhouette, served when an upstream
+// is down and there is no earlier render for the user.
+func placeholder() ([]byte, error) {
+	placeholderOnce.Do(func() {
+		const size = 400
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0xcf, 0xd9, 0xde, 0xff}}, image.Point{}, draw.Src)
+
+		//head and shoulders
+		fg := &image.Uniform{color.RGBA{0x8b, 0x98, 0xa5, 0xff}}
+		draw.DrawMask(img, img.Bounds(), fg, image.Point{}, &circle{image.Pt(size/2, size*3/8), size / 6}, image.Point{}, draw.Over)
+		draw.DrawMask(img, img.Bounds(), fg, image.Point{}, &circle{image.Pt(size/2, size), size * 3 / 8}, image.Point{}, draw.Over)
+
+		badge, err := decodeBadge()
+		if err != nil {
+			placeholderErr = err
+			return
+		}
+		result, err := composite(img, style{Badge: badge})
+		if err != nil {
+			placeholderErr = err
+			return
+		}
+		var buf bytes.Buffer
+		placeholderErr = png.Encode(&buf, result)
+		placeholderPNG = buf.Bytes()
+	})
+	return placeholderPNG, placeholderErr
+}
+
+// circle is an alpha mask of a filled circle.
+type circle struct {
+	p image.Point
+	r int
+}
+
+func (c *circle) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (c *circle) Bounds() image.Rectangle {
+	return image.Rect(c.p.X-c.r, c.p.Y-c.r, c.p.X+c.r, c.p.Y+c.r)
+}
+
+func (c *circle) At(x, y int) color.Color {
+	xx, yy, rr := float64(x-c.p.X)+0.5, float64(y-c.p.Y)+0.5, float64(c.r)
+	if xx*xx+yy*yy < rr*rr {
+		return color.Alpha{255}
+	}
+	return color.Alpha{0}
+}
@@ -0,0 +1,65 @@
+package avatar
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errNotPublic is returned for requests to hosts named by users that are
+// not plain https to a public address.
+var errNotPublic = errors.New("not a public https address")
+
+// carrier-grade NAT, which IsPrivate leaves out
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// newPublicTransport is a transport that only speaks https and refuses to
+// connect to private, loopback and link-local addresses. The address is
+// checked at dial time, after DNS resolution and on every redirect, so a host
+// name resolving to 127.0.0.1 or a redirect to the cloud metadata service
+// is refused too.
+func newPublicTransport() http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("dial %s: %w", address, errNotPublic)
+			}
+			return nil
+		},
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	//a proxy would be dialed instead of the host, skipping the check
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return httpsOnly{t}
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address.
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !sharedAddressSpace.Contains(ip)
+}
+
+// httpsOnly refuses every request, including redirects, that is not https.
+type httpsOnly struct {
+	base http.RoundTripper
+}
+
+func (t httpsOnly) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", req.URL.Redacted(), errNotPublic)
+	}
+	return t.base.RoundTrip(req)
+}
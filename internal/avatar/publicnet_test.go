@@ -0,0 +1,69 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::6810:85e5", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicTransportRefusesPrivateHosts(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback", url: srv.URL},
+		{name: "plain http", url: plain.URL},
+		{name: "metadata service", url: "http://169.254.169.254/latest/meta-data/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := downloadAvatar(context.Background(), fediverseClient, tt.url)
+			if !errors.Is(err, errNotPublic) {
+				t.Fatalf("downloadAvatar() = %v, want errNotPublic", err)
+			}
+			if code := errorClass(err); code != "address_not_allowed" {
+				t.Errorf("code = %q, want address_not_allowed", code)
+			}
+			if isUpstreamFailure(err) {
+				t.Error("a refused address counts against the breaker")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package avatar
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"rsc.io/qr"
+)
+
+// Where the QR code goes.
+const (
+	qrModeCorner = "corner"
+	qrModeCard   = "card"
+)
+
+const (
+	//a corner QR code aims for this fraction of the avatar width, and may
+	//grow to the larger one to keep its modules at the minimum size
+	qrOverlaySize = 0.3
+	qrMaxOverlay  = 0.5
+	//bounds of the qr_quiet and qr_min_module options
+	maxQRQuiet     = 8
+	minQRModule    = 2
+	maxQRModule    = 20
+	cardWidth      = 1200
+	cardHeight     = 630
+	cardAvatarSize = 380
+	//the QR code of a card fits in this square
+	cardQRSize = 500
+)
+
+// qrLevels are the error correction levels by their query names.
+var qrLevels = map[string]qr.Level{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+
+// qrStyle is a QR code linking to the Fediverse profile, over a corner of
+// the avatar or on a share card next to it.
+type qrStyle struct {
+	Mode   string
+	Corner string
+	Level  qr.Level
+	//Quiet is the blank margin around the code, in modules
+	Quiet int
+	//MinModule is the smallest size of a module, in pixels, that the
+	//code may be drawn at
+	MinModule int
+	//Handle is the account linked to, filled in once it is known
+	Handle fediHandle
+}
+
+func defaultQR() *qrStyle {
+	return &qrStyle{
+		Mode:      qrModeCorner,
+		Corner:    cornerBottomLeft,
+		Level:     qr.M,
+		Quiet:     4,
+		MinModule: 3,
+	}
+}
+
+// levelName is the query name of the error correction level of qs.
+func (qs *qrStyle) levelName() string {
+	for name, l := range qrLevels {
+		if l == qs.Level {
+			return name
+		}
+	}
+	return ""
+}
+
+// qrLayer renders qs as a layer in its corner of bounds. The code grows
+// past its usual size rather than shrink its modules below MinModule.
+func qrLayer(bounds image.Rectangle, qs *qrStyle) (ImageLayer, error) {
+	code, err := qr.Encode(qs.Handle.URL(), qs.Level)
+	if err != nil {
+		return ImageLayer{}, err
+	}
+	w, h := bounds.Dx(), bounds.Dy()
+	n := code.Size + 2*qs.Quiet
+	module := max(int(qrOverlaySize*float64(w))/n, qs.MinModule)
+	if n*module > int(qrMaxOverlay*float64(min(w, h))) {
+		return ImageLayer{}, errQRTooDense(qs, n)
+	}
+	img := qrImage(code, qs.Quiet, module)
+	size := img.Bounds().Dx()
+	layer := ImageLayer{Image: img}
+	switch qs.Corner {
+	case cornerTopRight:
+		layer.XPos = w - size
+	case cornerBottomLeft:
+		layer.YPos = h - size
+	case cornerBottomRight:
+		layer.XPos, layer.YPos = w-size, h-size
+	}
+	return layer, nil
+}
+
+// qrImage draws code with its quiet zone, every module module pixels wide.
+func qrImage(code *qr.Code, quiet, module int) *image.RGBA {
+	size := (code.Size + 2*quiet) * module
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				r := image.Rect(x+quiet, y+quiet, x+quiet+1, y+quiet+1)
+				draw.Draw(img, image.Rectangle{r.Min.Mul(module), r.Max.Mul(module)}, image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
+
+// shareCard lays out avatar and its handle next to a large QR code, in the
+// size link previews use.
+func shareCard(avatar image.Image, qs *qrStyle) (*image.RGBA, error) {
+	code, err := qr.Encode(qs.Handle.URL(), qs.Level)
+	if err != nil {
+		return nil, err
+	}
+	n := code.Size + 2*qs.Quiet
+	module := cardQRSize / n
+	if module < qs.MinModule {
+		return nil, errQRTooDense(qs, n)
+	}
+
+	card := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(card, card.Bounds(), image.White, image.Point{}, draw.Src)
+
+	//avatar and handle in the left half
+	left := cardWidth / 2
+	top := (cardHeight-cardAvatarSize)/2 - 30
+	at := image.Rect(0, 0, cardAvatarSize, cardAvatarSize).Add(image.Pt((left-cardAvatarSize)/2, top))
+	xdraw.CatmullRom.Scale(card, at, avatar, avatar.Bounds(), xdraw.Over, nil)
+
+	text := "@" + qs.Handle.String()
+	room := fixed.I(left - 80)
+	face, _, err := fitFace(captionFonts, text, 40, 20, func(font.Face) fixed.Int26_6 { return room })
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	text = truncate(face, text, room)
+	d := &font.Drawer{Dst: card, Src: &image.Uniform{color.RGBA{0x28, 0x2c, 0x37, 0xff}}, Face: face}
+	d.Dot = fixed.Point26_6{
+		X: fixed.I(left/2) - d.MeasureString(text)/2,
+		Y: fixed.I(at.Max.Y+30) + face.Metrics().Ascent,
+	}
+	d.DrawString(text)
+
+	//QR code centered in the right half
+	img := qrImage(code, qs.Quiet, module)
+	size := img.Bounds().Dx()
+	pos := image.Pt(left+(left-size)/2, (cardHeight-size)/2)
+	draw.Draw(card, img.Bounds().Add(pos), img, image.Point{}, draw.Src)
+	return card, nil
+}
+
+func errQRTooDense(qs *qrStyle, modules int) error {
+	return &apiError{
+		Status: http.StatusUnprocessableEntity,
+		Code:   "qr_too_dense",
+		Message: fmt.Sprintf("The QR code for %s is %d modules wide and does not fit with modules of %d pixels. Lower qr_level, qr_quiet or qr_min_module, or use qr=card.",
+			qs.Handle.URL(), modules, qs.MinModule),
+	}
+}
+
+func errNoHandle() error {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "no_fediverse_handle",
+		Message: "No Fediverse handle was found in the Twitter profile. Pass one with the handle parameter.",
+	}
+}
@@ -0,0 +1,282 @@
+package avatar
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var clientLimits *limiter
+
+// apiKey is a configured key and its daily quota, 0 meaning unlimited.
+type apiKey struct {
+	key   string
+	quota int
+}
+
+// limiter enforces token buckets per client IP and per API key, and the
+// daily quota of each key.
+type limiter struct {
+	keys       []apiKey
+	requireKey bool
+	trustProxy bool
+
+	ipRate, keyRate   rate.Limit
+	ipBurst, keyBurst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	usage   map[string]*dailyUsage
+	swept   time.Time
+}
+
+type bucket struct {
+	lim      *rate.Limiter
+	lastSeen time.Time
+}
+
+type dailyUsage struct {
+	day  string
+	used int
+}
+
+const (
+	//bucketIdle is how long an unused bucket is kept before it is dropped
+	bucketIdle = 10 * time.Minute
+	//maxBuckets caps the buckets kept at once, whatever the clients send
+	maxBuckets = 100000
+)
+
+func newLimiter(conf *Config, keys []apiKey) *limiter {
+	return &limiter{
+		keys:       keys,
+		requireKey: conf.RequireAPIKey,
+		trustProxy: conf.TrustProxy,
+		ipRate:     rate.Limit(conf.IPRateLimit),
+		ipBurst:    conf.IPRateBurst,
+		keyRate:    rate.Limit(conf.KeyRateLimit),
+		keyBurst:   conf.KeyRateBurst,
+		buckets:    make(map[string]*bucket),
+		usage:      make(map[string]*dailyUsage),
+	}
+}
+
+// loadAPIKeys reads "key:quota" entries from the config and from the optional
+// keys file, which holds one entry per line and allows # comments.
+func loadAPIKeys(conf *Config) ([]apiKey, error) {
+	entries := append([]string{}, conf.APIKeys...)
+	if conf.APIKeysFile != "" {
+		f, err := os.Open(conf.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("config: APIKeysFile: %w", err)
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("config: APIKeysFile: %w", err)
+		}
+	}
+	var keys []apiKey
+	for i, entry := range entries {
+		key, quota, found := strings.Cut(strings.TrimSpace(entry), ":")
+		k := apiKey{key: key}
+		if found {
+			q, err := strconv.Atoi(quota)
+			if err != nil || q < 0 {
+				return nil, fmt.Errorf("config: API key %d has an invalid quota %q", i, quota)
+			}
+			k.quota = q
+		}
+		if k.key == "" {
+			return nil, fmt.Errorf("config: API key %d is empty", i)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// withRateLimit rejects requests that lack a required API key (signed links
+// stand in for one), exceed their
+// key's daily quota or exceed the per IP or per key rate, and reports the
+// limit that applies in X-RateLimit-* headers.
+func withRateLimit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clientLimits == nil {
+			h(w, r)
+			return
+		}
+		if err := clientLimits.allow(w, r); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (l *limiter) allow(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now()
+	presented := r.Header.Get("X-API-Key")
+	if presented == "" {
+		presented = r.URL.Query().Get("api_key")
+	}
+	key, ok := l.lookup(presented)
+	switch {
+	case presented != "" && !ok:
+		return &apiError{Status: http.StatusUnauthorized, Code: "invalid_api_key", Message: "The API key is not valid."}
+	case !ok && l.requireKey && !isSigned(r.Context()):
+		return &apiError{Status: http.StatusUnauthorized, Code: "api_key_required", Message: "An API key is required, send it in the X-API-Key header."}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var b *bucket
+	if ok {
+		b = l.bucket("key:"+key.key, l.keyRate, l.keyBurst, now)
+	} else {
+		b = l.bucket("ip:"+l.clientIP(r), l.ipRate, l.ipBurst, now)
+	}
+	if !b.lim.AllowN(now, 1) {
+		wait := time.Duration(float64(time.Second) / float64(b.lim.Limit()))
+		setRateLimitHeaders(w, b.lim.Burst(), 0, wait)
+		return errClientRateLimited(wait)
+	}
+
+	if ok && key.quota > 0 {
+		day := now.UTC().Format("2006-01-02")
+		u := l.usage[key.key]
+		if u == nil || u.day != day {
+			u = &dailyUsage{day: day}
+			l.usage[key.key] = u
+		}
+		untilReset := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+		if u.used >= key.quota {
+			setRateLimitHeaders(w, key.quota, 0, untilReset)
+			return &apiError{
+				Status:     http.StatusTooManyRequests,
+				Code:       "quota_exceeded",
+				Message:    "The daily quota of this API key is used up.",
+				RetryAfter: untilReset,
+			}
+		}
+		u.used++
+		setRateLimitHeaders(w, key.quota, key.quota-u.used, untilReset)
+		return nil
+	}
+	remaining := int(b.lim.TokensAt(now))
+	untilFull := time.Duration(float64(b.lim.Burst()-remaining) / float64(b.lim.Limit()) * float64(time.Second))
+	setRateLimitHeaders(w, b.lim.Burst(), remaining, untilFull)
+	return nil
+}
+
+// lookup finds the configured key matching presented, in constant time per key.
+func (l *limiter) lookup(presented string) (apiKey, bool) {
+	if presented == "" {
+		return apiKey{}, false
+	}
+	for _, k := range l.keys {
+		if subtle.ConstantTimeCompare([]byte(k.key), []byte(presented)) == 1 {
+			return k, true
+		}
+	}
+	return apiKey{}, false
+}
+
+// bucket returns the token bucket for id, creating it if needed. l.mu must be held.
+func (l *limiter) bucket(id string, r rate.Limit, burst int, now time.Time) *bucket {
+	b, ok := l.buckets[id]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.evict(now)
+		}
+		b = &bucket{lim: rate.NewLimiter(r, burst)}
+		l.buckets[id] = b
+	}
+	b.lastSeen = now
+	return b
+}
+
+// sweep drops idle buckets now and then. l.mu must be held.
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < bucketIdle {
+		return
+	}
+	l.swept = now
+	for id, b := range l.buckets {
+		if now.Sub(b.lastSeen) > bucketIdle {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// evict makes room for a new bucket when maxBuckets is reached: idle buckets
+// go first, then the least recently seen one. l.mu must be held.
+func (l *limiter) evict(now time.Time) {
+	l.swept = time.Time{}
+	l.sweep(now)
+	if len(l.buckets) < maxBuckets {
+		return
+	}
+	var oldest string
+	for id, b := range l.buckets {
+		if oldest == "" || b.lastSeen.Before(l.buckets[oldest].lastSeen) {
+			oldest = id
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+// clientIP is the address of the client. Behind a trusted proxy such as
+// Vercel's edge it is the right-most X-Forwarded-For entry, the one the proxy
+// appended itself; the entries before it are whatever the client sent.
+func (l *limiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		fwd := r.Header.Values("X-Forwarded-For")
+		if len(fwd) > 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Duration) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+}
+
+func errClientRateLimited(wait time.Duration) error {
+	return &apiError{
+		Status:     http.StatusTooManyRequests,
+		Code:       "client_rate_limited",
+		Message:    "Too many requests, slow down.",
+		RetryAfter: wait,
+	}
+}
@@ -0,0 +1,126 @@
+package avatar
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testLimiter(conf Config, keys ...apiKey) *limiter {
+	return newLimiter(&conf, keys)
+}
+
+func TestLimiterQuotas(t *testing.T) {
+	conf := Config{IPRateLimit: 1000, IPRateBurst: 1000, KeyRateLimit: 1000, KeyRateBurst: 1000}
+	tests := []struct {
+		name       string
+		requireKey bool
+		apiKey     string
+		requests   int
+		wantCode   string //of the last request, "" for allowed
+		wantLeft   string
+	}{
+		{name: "within quota", apiKey: "k3", requests: 2, wantLeft: "1"},
+		{name: "quota used up", apiKey: "k3", requests: 3, wantLeft: "0"},
+		{name: "over quota", apiKey: "k3", requests: 4, wantCode: "quota_exceeded", wantLeft: "0"},
+		{name: "unlimited key", apiKey: "free", requests: 10},
+		{name: "unknown key", apiKey: "nope", requests: 1, wantCode: "invalid_api_key"},
+		{name: "key required", requireKey: true, requests: 1, wantCode: "api_key_required"},
+		{name: "no key", requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := conf
+			conf.RequireAPIKey = tt.requireKey
+			l := testLimiter(conf, apiKey{key: "k3", quota: 3}, apiKey{key: "free"})
+
+			var err error
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				rec = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/api/mastodon?username=jack", nil)
+				if tt.apiKey != "" {
+					req.Header.Set("X-API-Key", tt.apiKey)
+				}
+				err = l.allow(rec, req)
+			}
+			if got := errorClass(err); err != nil && got != tt.wantCode || err == nil && tt.wantCode != "" {
+				t.Fatalf("allow() = %v, want code %q", err, tt.wantCode)
+			}
+			if tt.wantLeft != "" {
+				if got := rec.Header().Get("X-RateLimit-Remaining"); got != tt.wantLeft {
+					t.Errorf("X-RateLimit-Remaining = %q, want %q", got, tt.wantLeft)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := testLimiter(Config{IPRateLimit: 1, IPRateBurst: 2, KeyRateLimit: 1, KeyRateBurst: 5})
+	var err error
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err = l.allow(httptest.NewRecorder(), req)
+	}
+	var e *apiError
+	if !errors.As(err, &e) || e.Code != "client_rate_limited" {
+		t.Fatalf("third request = %v, want client_rate_limited", err)
+	}
+	if e.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", e.RetryAfter)
+	}
+
+	//another IP has a bucket of its own
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	if err := l.allow(httptest.NewRecorder(), req); err != nil {
+		t.Errorf("request from another IP = %v", err)
+	}
+}
+
+func TestLimiterBucketsAreBounded(t *testing.T) {
+	l := testLimiter(Config{IPRateLimit: 1, IPRateBurst: 1})
+	now := time.Now()
+	for i := 0; i < maxBuckets+10; i++ {
+		l.bucket("ip:"+strconv.Itoa(i), l.ipRate, l.ipBurst, now.Add(time.Duration(i)))
+	}
+	if len(l.buckets) > maxBuckets {
+		t.Errorf("%d buckets, want at most %d", len(l.buckets), maxBuckets)
+	}
+	if _, ok := l.buckets["ip:0"]; ok {
+		t.Error("least recently seen bucket was kept")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  []string
+		want       string
+	}{
+		{name: "proxy not trusted", forwarded: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{name: "no header", trustProxy: true, want: "192.0.2.1"},
+		{name: "single hop", trustProxy: true, forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "spoofed first hop", trustProxy: true, forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "repeated header", trustProxy: true, forwarded: []string{"203.0.113.9", "198.51.100.7"}, want: "198.51.100.7"},
+		{name: "garbage", trustProxy: true, forwarded: []string{"203.0.113.9, not-an-ip"}, want: "192.0.2.1"},
+		{name: "ipv6", trustProxy: true, forwarded: []string{"2001:db8::1"}, want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testLimiter(Config{TrustProxy: tt.trustProxy})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := l.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	//in-flight renders, keyed by cacheKey
+	renders flightGroup
+
+	//semaphore bounding concurrent decode/encode work
+	renderSlots        chan struct{}
+	renderQueueTimeout time.Duration
+
+	//per-stage deadlines
+	lookupTimeout   time.Duration
+	downloadTimeout time.Duration
+	renderTimeout   time.Duration
+)
+
+// cacheKey identifies the output of a render. Twitter screen names are
+// case-insensitive, so they are folded to share the same render.
+func cacheKey(username string) string {
+	return strings.ToLower(username)
+}
+
+// acquireRenderSlot waits up to renderQueueTimeout for a free render slot.
+// The returned func must be called to give the slot back.
+func acquireRenderSlot(ctx context.Context) (release func(), err error) {
+	timer := time.NewTimer(renderQueueTimeout)
+	defer timer.Stop()
+	select {
+	case renderSlots <- struct{}{}:
+		return func() { <-renderSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, &apiError{
+			Status:     http.StatusServiceUnavailable,
+			Code:       "busy",
+			Message:    "Too busy, try again in a moment.",
+			RetryAfter: renderQueueTimeout,
+		}
+	}
+}
+
+// lookupUser fetches the Twitter user behind the circuit breaker.
+func lookupUser(ctx context.Context, username string) (*twitter.User, error) {
+	if err := twitterBreaker.allow(); err != nil {
+		return nil, err
+	}
+	lctx, st := startStage(ctx, stageTwitterLookup)
+	st.span.SetAttributes(attribute.String("twitter.username", logUser(username)))
+	lctx, cancel := context.WithTimeout(lctx, lookupTimeout)
+	var usr *twitter.User
+	resp, err := twitterPool.do(lctx, endpointUsersShow, func(client *twitter.Client) (resp *http.Response, err error) {
+		usr, resp, err = client.Users.Show(&twitter.UserShowParams{
+			ScreenName: username,
+		})
+		return resp, err
+	})
+	cancel()
+	if err != nil {
+		err = twitterError(username, resp, err)
+	}
+	st.end(err)
+	twitterBreaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+	loggerFrom(ctx).Debug("looked up user", "username", logUser(username))
+	return usr, nil
+}
+
+// render looks up the user's avatar and returns the badged avatar as PNG.
+func render(ctx context.Context, username string, opts renderOptions) ([]byte, error) {
+	usr, err := lookupUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Protected {
+		return nil, errUserProtected(username)
+	}
+	return renderUser(ctx, usr, opts)
+}
+
+// renderUser returns the badged avatar of an already looked up user as PNG.
+func renderUser(ctx context.Context, usr *twitter.User, opts renderOptions) ([]byte, error) {
+	avatar := originalAvatarURL(usr)
+	badge, err := loadBadge(ctx, opts.Badge, "")
+	if err != nil {
+		return nil, err
+	}
+	st := style{Badge: badge, SkipIfBadged: true, BadgeStyle: opts.BadgeStyle}
+	if opts.Ring != nil {
+		ring := *opts.Ring
+		st.Ring = &ring
+	}
+	st.Ribbon = opts.Ribbon
+	if opts.QR != nil {
+		code := *opts.QR
+		st.QR = &code
+	}
+	if opts.ShowHandle || opts.Verify || st.Ring != nil && st.Ring.Text == "" || st.QR != nil {
+		candidates := profileHandles(ctx, usr)
+		h, ok := opts.Handle, opts.Handle != (fediHandle{})
+		if !ok && len(candidates) > 0 {
+			h, ok = candidates[0].handle, true
+		}
+		if ok && opts.ShowHandle {
+			st.Caption = "@" + h.String()
+		}
+		if st.Ring != nil && st.Ring.Text == "" {
+			st.Ring.Text = ringDefaultText
+			if ok {
+				st.Ring.Text += " • @" + h.String()
+			}
+		}
+		if st.QR != nil {
+			if !ok {
+				return nil, errNoHandle()
+			}
+			st.QR.Handle = h
+		}
+		if ok && opts.Verify {
+			v, err := verifyHandle(ctx, usr, h, candidates)
+			if err != nil {
+				//an unreachable instance only costs the check mark
+				loggerFrom(ctx).Warn("verifying handle failed", errorAttrs(err)...)
+			} else if v.Verified {
+				st.Badge = verifiedBadge(badge)
+			}
+		}
+	}
+	if opts.Caption != "" {
+		st.Caption = opts.Caption
+	}
+	return renderAvatar(ctx, avatar, st)
+}
+
+// renderAvatar composites st onto the Twitter avatar at avatarURL and returns
+// the result as PNG.
+func renderAvatar(ctx context.Context, avatarURL string, st style) ([]byte, error) {
+	return renderAvatarFrom(ctx, upstreamClient, avatarBreaker, avatarURL, st)
+}
+
+// renderMastodonAvatar is renderAvatar for an avatar hosted by a Mastodon
+// instance, which is fetched as a user-named host behind its own breaker.
+func renderMastodonAvatar(ctx context.Context, avatarURL string, st style) ([]byte, error) {
+	return renderAvatarFrom(ctx, fediverseClient, mastodonBreaker, avatarURL, st)
+}
+
+func renderAvatarFrom(ctx context.Context, client *http.Client, b *breaker, avatarURL string, st style) ([]byte, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	body, err := fetchAvatar(ctx, client, avatarURL)
+	b.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	//the slot only covers the CPU-bound work, a slow CDN must not hold it
+	release, err := acquireRenderSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result, err := combineImages(ctx, body, st)
+	if err != nil {
+		return nil, err
+	}
+	ectx, stg := startStage(ctx, stageEncode)
+	ectx, cancel := context.WithTimeout(ectx, renderTimeout)
+	defer cancel()
+	var buf bytes.Buffer
+	err = png.Encode(&ctxWriter{ectx, &buf}, result)
+	if err != nil {
+		err = stageError(err)
+	}
+	stg.end(err)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes.Observe(float64(buf.Len()))
+	return buf.Bytes(), nil
+}
+
+// maxImagePixels is the largest image we decode. A few kilobytes of PNG or
+// GIF can declare a canvas that takes gigabytes to decode into.
+const maxImagePixels = 4096 * 4096
+
+// errImagePixels is returned by decodeImage for images over maxImagePixels.
+var errImagePixels = fmt.Errorf("image has more than %d pixels", maxImagePixels)
+
+// decodeImage decodes body once its header shows it is within
+// maxImagePixels, and stops once ctx is done.
+func decodeImage(ctx context.Context, body []byte) (image.Image, error) {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if conf.Width <= 0 || conf.Height <= 0 || conf.Width > maxImagePixels/conf.Height {
+		return nil, errImagePixels
+	}
+	img, _, err := image.Decode(&ctxReader{ctx, bytes.NewReader(body)})
+	return img, err
+}
+
+// ctxReader stops a decode once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxWriter stops an encode once its context is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// stageError turns an error caused by the stage's own deadline into a
+// render_timeout apiError. Other errors, including cancellation, pass
+// through unchanged.
+func stageError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &apiError{
+			Status:  http.StatusGatewayTimeout,
+			Code:    "render_timeout",
+			Message: "Rendering the avatar took too long.",
+			Err:     err,
+		}
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package avatar
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Corners a ribbon can go across.
+const (
+	cornerTopLeft     = "top_left"
+	cornerTopRight    = "top_right"
+	cornerBottomLeft  = "bottom_left"
+	cornerBottomRight = "bottom_right"
+)
+
+const (
+	ribbonDefaultText = "Now on Mastodon"
+	//the band spans these distances from the corner, measured along the
+	//edges, as fractions of the avatar width
+	ribbonNear = 0.3
+	ribbonFar  = 0.48
+	//ribbon text is fitted between these fractions of the band width
+	ribbonMaxSize = 0.6
+	ribbonMinSize = 0.35
+)
+
+// ribbonStyle is a diagonal band across a corner of the avatar with text
+// along it, in place of the badge.
+type ribbonStyle struct {
+	Corner    string
+	Text      string
+	Color     color.NRGBA
+	TextColor color.NRGBA
+}
+
+func defaultRibbon() *ribbonStyle {
+	return &ribbonStyle{
+		Corner:    cornerTopLeft,
+		Text:      ribbonDefaultText,
+		Color:     color.NRGBA{0x63, 0x64, 0xff, 0xff},
+		TextColor: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+	}
+}
+
+// ribbonLayer renders rs as a layer covering the corner of bounds it runs
+// across, with a soft shadow. The band runs from edge to edge, and the
+// avatar bounds cut off its shadow.
+func ribbonLayer(bounds image.Rectangle, rs *ribbonStyle) (ImageLayer, error) {
+	w, h := bounds.Dx(), bounds.Dy()
+	s := float64(min(w, h))
+	near, far := ribbonNear*s, ribbonFar*s
+
+	//the band stays within far of the corner, so the layer and the shadow
+	//cast from it need be no larger than that square
+	size := min(int(math.Ceil(far)), w, h)
+	var at image.Point
+	switch rs.Corner {
+	case cornerTopRight:
+		at = image.Pt(w-size, 0)
+	case cornerBottomLeft:
+		at = image.Pt(0, h-size)
+	case cornerBottomRight:
+		at = image.Pt(w-size, h-size)
+	}
+
+	//corner maps a point given relative to the top left corner to rs.Corner,
+	//in the layer's pixels
+	corner := func(x, y float64) (float64, float64) {
+		switch rs.Corner {
+		case cornerTopRight:
+			return float64(size) - x, y
+		case cornerBottomLeft:
+			return x, float64(size) - y
+		case cornerBottomRight:
+			return float64(size) - x, float64(size) - y
+		}
+		return x, y
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	z := vector.NewRasterizer(size, size)
+	for i, p := range [][2]float64{{near, 0}, {far, 0}, {0, far}, {0, near}} {
+		x, y := corner(p[0], p[1])
+		if i == 0 {
+			z.MoveTo(float32(x), float32(y))
+		} else {
+			z.LineTo(float32(x), float32(y))
+		}
+	}
+	z.ClosePath()
+	z.Draw(img, img.Bounds(), &image.Uniform{rs.Color}, image.Point{})
+
+	if rs.Text != "" {
+		if err := drawRibbonText(img, rs, corner, near, far); err != nil {
+			return ImageLayer{}, err
+		}
+	}
+	return ImageLayer{
+		Image: img,
+		XPos:  at.X,
+		YPos:  at.Y,
+		Shadow: &dropShadow{
+			Color:  color.NRGBA{0, 0, 0, 0x80},
+			Offset: image.Pt(0, max(int(s/100), 1)),
+			Blur:   s / 100,
+		},
+	}, nil
+}
+
+// drawRibbonText draws the text of rs centered on the band between near
+// and far, rotated to run along it and reading left to right.
+func drawRibbonText(img *image.RGBA, rs *ribbonStyle, corner func(x, y float64) (float64, float64), near, far float64) error {
+	band := (far - near) / math.Sqrt2
+	//the band's middle line is shorter toward the corner, by twice the
+	//distance: the top or bottom of the text, with some padding, limits
+	//how long it may be
+	middle := (near + far) / math.Sqrt2
+	face, room, err := fitFace(captionFonts, rs.Text, band*ribbonMaxSize, band*ribbonMinSize, func(f font.Face) fixed.Int26_6 {
+		m := f.Metrics()
+		return fixed.Int26_6(middle*64) - m.Ascent - m.Descent - fixed.Int26_6(band/3*64)
+	})
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+	text := truncate(face, rs.Text, room)
+
+	//draw the text level first, then rotate it into place
+	m := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := (m.Ascent + m.Descent).Ceil()
+	level := image.NewRGBA(image.Rect(0, 0, width, height))
+	d := &font.Drawer{Dst: level, Src: &image.Uniform{rs.TextColor}, Face: face, Dot: fixed.Point26_6{Y: m.Ascent}}
+	d.DrawString(text)
+
+	//the band rises to the right across the top left and bottom right
+	//corners, and falls across the others
+	angle := -math.Pi / 4
+	if rs.Corner == cornerTopRight || rs.Corner == cornerBottomLeft {
+		angle = math.Pi / 4
+	}
+	mid := (near + far) / 4
+	cx, cy := corner(mid, mid)
+	sin, cos := math.Sincos(angle)
+	u, v := -float64(width)/2, -float64(height)/2
+	s2d := f64.Aff3{
+		cos, -sin, cx + u*cos - v*sin,
+		sin, cos, cy + u*sin + v*cos,
+	}
+	xdraw.BiLinear.Transform(img, s2d, level, level.Bounds(), xdraw.Over, nil)
+	return nil
+}
@@ -0,0 +1,52 @@
+package avatar
+
+import (
+	"image"
+	"testing"
+)
+
+// The ribbon layer, and the shadow cast from it, only cover the corner the
+// band runs across, whatever the size of the avatar.
+func TestRibbonLayerCoversItsCorner(t *testing.T) {
+	bounds := image.Rect(0, 0, 1024, 768)
+	tests := []struct {
+		corner string
+		wantAt image.Point
+	}{
+		{corner: cornerTopLeft, wantAt: image.Pt(0, 0)},
+		{corner: cornerTopRight, wantAt: image.Pt(1024-369, 0)},
+		{corner: cornerBottomLeft, wantAt: image.Pt(0, 768-369)},
+		{corner: cornerBottomRight, wantAt: image.Pt(1024-369, 768-369)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.corner, func(t *testing.T) {
+			rs := defaultRibbon()
+			rs.Corner, rs.Text = tt.corner, ""
+			layer, err := ribbonLayer(bounds, rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := layer.Image.Bounds().Size(); got != image.Pt(369, 369) {
+				t.Errorf("layer size = %v, want 369x369", got)
+			}
+			if got := image.Pt(layer.XPos, layer.YPos); got != tt.wantAt {
+				t.Errorf("layer at %v, want %v", got, tt.wantAt)
+			}
+			//the band itself is drawn in the corner of the layer
+			cx, cy := 0, 0
+			if tt.wantAt.X > 0 {
+				cx = 368
+			}
+			if tt.wantAt.Y > 0 {
+				cy = 368
+			}
+			if _, _, _, a := layer.Image.At(cx, cy).RGBA(); a != 0 {
+				t.Errorf("corner pixel is covered, the band should leave it clear")
+			}
+			mask, _ := layer.Shadow.cast(layer.Image)
+			if pad := 2 * 24; mask.Bounds().Dx() != 369+pad || mask.Bounds().Dy() != 369+pad {
+				t.Errorf("shadow mask = %v, want the layer plus %d", mask.Bounds(), pad)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package avatar
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+const (
+	//ring text is fitted between these fractions of the ring thickness
+	ringMaxSize = 0.6
+	ringMinSize = 0.35
+	//share of the circumference the text may take, leaving a gap where it
+	//starts and ends
+	ringTextArc     = 0.95
+	ringDefaultText = "FIND ME ON MASTODON"
+	//badge width inside a ring, as a fraction of the avatar width
+	ringBadgeSize = 0.3
+	//bounds of the ring_thickness option, in percent of the avatar width
+	minRingThickness = 4
+	maxRingThickness = 25
+)
+
+// ringFonts are the fonts of the text ring, with the caption fallbacks.
+var ringFonts []*opentype.Font
+
+// ringStyle is a colored ring around a circular avatar with text set along
+// it, like LinkedIn's #OpenToWork frame.
+type ringStyle struct {
+	Text      string
+	Color     color.NRGBA
+	TextColor color.NRGBA
+	//Thickness is the width of the ring as a fraction of the avatar width
+	Thickness float64
+	//Start is where the text begins, in degrees clockwise from the top
+	Start float64
+}
+
+func defaultRing() *ringStyle {
+	return &ringStyle{
+		Color:     color.NRGBA{0x63, 0x64, 0xff, 0xff},
+		TextColor: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		Thickness: 0.12,
+		//lower left, so the text runs up and over the top
+		Start: 225,
+	}
+}
+
+// clipCircle returns img cut to the largest circle centered in it, with
+// transparent corners.
+func clipCircle(img image.Image) *image.RGBA {
+	return clipCircleIn(img, img.Bounds())
+}
+
+// clipCircleIn returns img cut to the largest circle centered in frame,
+// which is given in the coordinates of img and may reach past it.
+func clipCircleIn(img image.Image, frame image.Rectangle) *image.RGBA {
+	b := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	mask := image.NewAlpha(result.Bounds())
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	f := frame.Sub(b.Min)
+	cx, cy := float32(f.Min.X)+float32(f.Dx())/2, float32(f.Min.Y)+float32(f.Dy())/2
+	circlePath(z, cx, cy, min(float32(f.Dx()), float32(f.Dy()))/2, false)
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	draw.DrawMask(result, result.Bounds(), img, b.Min, mask, image.Point{}, draw.Src)
+	return result
+}
+
+// drawRing renders rs as a layer the size of bounds: the ring along the
+// edge of the inscribed circle and its text, shrunk to fit and cut short
+// with an ellipsis like captions.
+func drawRing(bounds image.Rectangle, rs *ringStyle) (*image.RGBA, error) {
+	w, h := bounds.Dx(), bounds.Dy()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	cx, cy := float64(w)/2, float64(h)/2
+	outer := math.Min(cx, cy)
+	thickness := math.Max(rs.Thickness*float64(w), 1)
+
+	//the ring is the outer circle minus the inner one, wound the other way
+	z := vector.NewRasterizer(w, h)
+	circlePath(z, float32(cx), float32(cy), float32(outer), false)
+	circlePath(z, float32(cx), float32(cy), float32(outer-thickness), true)
+	z.Draw(img, img.Bounds(), &image.Uniform{rs.Color}, image.Point{})
+
+	if rs.Text == "" {
+		return img, nil
+	}
+	//the text is set on a baseline below the middle of the ring, so the
+	//letters are centered in it and upright when seen from outside; its
+	//length there is the room the text has
+	middle := outer - thickness/2
+	var baseline float64
+	face, room, err := fitFace(ringFonts, rs.Text, thickness*ringMaxSize, thickness*ringMinSize, func(f font.Face) fixed.Int26_6 {
+		m := f.Metrics()
+		baseline = middle - float64(m.Ascent-m.Descent)/2/64
+		return fixed.Int26_6(2 * math.Pi * baseline * ringTextArc * 64)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	text := truncate(face, rs.Text, room)
+
+	src := &image.Uniform{rs.TextColor}
+	angle := rs.Start * math.Pi / 180
+	prev := rune(-1)
+	for _, r := range text {
+		if prev >= 0 {
+			angle += float64(face.Kern(prev, r)) / 64 / baseline
+		}
+		prev = r
+		adv, _ := face.GlyphAdvance(r)
+		advance := float64(adv) / 64
+		dr, mask, maskp, _, ok := face.Glyph(fixed.Point26_6{}, r)
+		if ok && !dr.Empty() {
+			glyph := image.NewRGBA(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+			draw.DrawMask(glyph, glyph.Bounds(), src, image.Point{}, mask, maskp, draw.Src)
+			drawGlyphOnArc(img, glyph, dr.Min, advance, cx, cy, baseline, angle+advance/2/baseline)
+		}
+		angle += advance / baseline
+	}
+	return img, nil
+}
+
+// ringBadgeLayer shrinks badge and tucks it inside the ring of rs, with
+// its bottom right corner on the inner edge, so it doesn't hide the text.
+func ringBadgeLayer(badge image.Image, bounds image.Rectangle, rs *ringStyle) ImageLayer {
+	b := badge.Bounds()
+	w := max(int(ringBadgeSize*float64(bounds.Dx())), 1)
+	h := max(w*b.Dy()/b.Dx(), 1)
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), badge, b, xdraw.Over, nil)
+
+	cx, cy := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+	inner := math.Min(cx, cy) - rs.Thickness*float64(bounds.Dx())
+	corner := inner * math.Sqrt2 / 2
+	return ImageLayer{
+		Image: scaled,
+		XPos:  int(cx+corner) - w,
+		YPos:  int(cy+corner) - h,
+	}
+}
+
+// drawGlyphOnArc draws glyph, whose top left corner is at origin relative
+// to its dot, rotated so its baseline is tangent to the circle of radius
+// radius at angle, in radians clockwise from the top.
+func drawGlyphOnArc(dst *image.RGBA, glyph *image.RGBA, origin image.Point, advance, cx, cy, radius, angle float64) {
+	sin, cos := math.Sincos(angle)
+	//where the middle of the glyph's baseline lands
+	px, py := cx+radius*sin, cy-radius*cos
+	u, v := float64(origin.X)-advance/2, float64(origin.Y)
+	s2d := f64.Aff3{
+		cos, -sin, px + u*cos - v*sin,
+		sin, cos, py + u*sin + v*cos,
+	}
+	xdraw.BiLinear.Transform(dst, s2d, glyph, glyph.Bounds(), xdraw.Over, nil)
+}
+
+// circlePath adds a circle to z as four cubic Béziers, clockwise or, with
+// reverse, counterclockwise.
+func circlePath(z *vector.Rasterizer, cx, cy, r float32, reverse bool) {
+	//control point distance for a quarter circle
+	k := r * 0.5523
+	//mirroring the x offsets turns the path around
+	sx := float32(1)
+	if reverse {
+		sx = -1
+	}
+	z.MoveTo(cx, cy-r)
+	z.CubeTo(cx+sx*k, cy-r, cx+sx*r, cy-k, cx+sx*r, cy)
+	z.CubeTo(cx+sx*r, cy+k, cx+sx*k, cy+r, cx, cy+r)
+	z.CubeTo(cx-sx*k, cy+r, cx-sx*r, cy+k, cx-sx*r, cy)
+	z.CubeTo(cx-sx*r, cy-k, cx-sx*k, cy-r, cx, cy-r)
+	z.ClosePath()
+}
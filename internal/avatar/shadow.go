@@ -0,0 +1,89 @@
+package avatar
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// dropShadow is a blurred, offset silhouette drawn under a layer.
+type dropShadow struct {
+	Color color.NRGBA
+	//Offset moves the shadow relative to the layer
+	Offset image.Point
+	//Blur is the standard deviation of the Gaussian blur, in pixels
+	Blur float64
+}
+
+// cast returns the shadow of img as a mask to draw s.Color through, and
+// where its top left corner goes, relative to the top left corner of img.
+// The mask is larger than img by the reach of the blur on every side, so
+// layers should be no larger than what they show.
+func (s *dropShadow) cast(img image.Image) (*image.Alpha, image.Point) {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+	pad := int(math.Ceil(3 * s.Blur))
+	w, h := b.Dx()+2*pad, b.Dy()+2*pad
+	alpha := make([]float64, w*h)
+	for y := 0; y < b.Dy(); y++ {
+		row := rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < b.Dx(); x++ {
+			alpha[(y+pad)*w+x+pad] = float64(row[4*x+3]) / 0xff
+		}
+	}
+	if s.Blur > 0 {
+		gaussianBlur(alpha, w, h, s.Blur)
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	for i, a := range alpha {
+		mask.Pix[i] = uint8(math.Round(math.Min(a, 1) * 255))
+	}
+	return mask, s.Offset.Sub(image.Pt(pad, pad))
+}
+
+// gaussianBlur blurs the w by h values in v in place with a Gaussian of
+// standard deviation sigma, as a horizontal and then a vertical pass. Values
+// past the edges count as zero.
+func gaussianBlur(v []float64, w, h int, sigma float64) {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	tmp := make([]float64, len(v))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var acc float64
+			for i, k := range kernel {
+				if xx := x + i - radius; xx >= 0 && xx < w {
+					acc += k * v[y*w+xx]
+				}
+			}
+			tmp[y*w+x] = acc
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var acc float64
+			for i, k := range kernel {
+				if yy := y + i - radius; yy >= 0 && yy < h {
+					acc += k * tmp[yy*w+x]
+				}
+			}
+			v[y*w+x] = acc
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package avatar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kiwiidb/mastodon-in-twitter-avatar/signedlink"
+)
+
+const testSigningSecret = "test-secret"
+
+// setSigning configures signed links for the duration of the test.
+func setSigning(t *testing.T, secret string, require bool) {
+	t.Helper()
+	oldSecret, oldRequire := signingSecret, requireSignature
+	signingSecret, requireSignature = []byte(secret), require
+	t.Cleanup(func() { signingSecret, requireSignature = oldSecret, oldRequire })
+}
+
+func signedQuery(params url.Values, expires time.Time) url.Values {
+	return signedlink.SignQuery(testSigningSecret, params, expires)
+}
+
+// errorCode is the error code of a JSON error response, "" if there is none.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Code < 400 {
+		return ""
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", rec.Body.String(), err)
+	}
+	return body.Error.Code
+}
+
+func TestWithSignature(t *testing.T) {
+	params := url.Values{"username": {"jack"}, "caption": {"hi"}}
+	valid := signedQuery(params, time.Now().Add(time.Hour))
+	tampered := signedQuery(params, time.Now().Add(time.Hour))
+	tampered.Set("username", "elon")
+	added := signedQuery(params, time.Now().Add(time.Hour))
+	added.Set("ring", "true")
+	extended := signedQuery(params, time.Now().Add(time.Hour))
+	extended.Set("expires", "99999999999")
+	wrongSecret := signedlink.SignQuery("other-secret", params, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		require    bool
+		query      url.Values
+		wantStatus int
+		wantCode   string
+		wantSigned bool
+	}{
+		{name: "valid", query: valid, wantStatus: http.StatusOK, wantSigned: true},
+		{name: "valid when required", require: true, query: valid, wantStatus: http.StatusOK, wantSigned: true},
+		{name: "unsigned", query: params, wantStatus: http.StatusOK},
+		{name: "unsigned when required", require: true, query: params, wantStatus: http.StatusUnauthorized, wantCode: "signature_required"},
+		{name: "tampered parameter", query: tampered, wantStatus: http.StatusForbidden, wantCode: "invalid_signature"},
+		{name: "added parameter", query: added, wantStatus: http.StatusForbidden, wantCode: "invalid_signature"},
+		{name: "extended expiry", query: extended, wantStatus: http.StatusForbidden, wantCode: "invalid_signature"},
+		{name: "wrong secret", query: wrongSecret, wantStatus: http.StatusForbidden, wantCode: "invalid_signature"},
+		{name: "expired", query: signedQuery(params, time.Now().Add(-time.Minute)), wantStatus: http.StatusForbidden, wantCode: "signature_expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSigning(t, testSigningSecret, tt.require)
+			var signed bool
+			h := withSignature(func(w http.ResponseWriter, r *http.Request) {
+				signed = isSigned(r.Context())
+			})
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "/api/mastodon?"+tt.query.Encode(), nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if code := errorCode(t, rec); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if signed != tt.wantSigned {
+				t.Errorf("isSigned = %v, want %v", signed, tt.wantSigned)
+			}
+		})
+	}
+}
+
+// Signed links stand in for an API key, so the signature has to be checked
+// before the rate limit.
+func TestServeSignedSkipsAPIKeyForSignedLinks(t *testing.T) {
+	setSigning(t, testSigningSecret, false)
+	oldLimits := clientLimits
+	clientLimits = newLimiter(&Config{RequireAPIKey: true, IPRateLimit: 100, IPRateBurst: 100}, nil)
+	t.Cleanup(func() { clientLimits = oldLimits })
+
+	params := url.Values{"username": {"jack"}}
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "signed", query: signedQuery(params, time.Now().Add(time.Hour)), wantStatus: http.StatusOK},
+		{name: "unsigned", query: params, wantStatus: http.StatusUnauthorized, wantCode: "api_key_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := serveSigned("test", func(w http.ResponseWriter, r *http.Request) {})
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "/api/mastodon?"+tt.query.Encode(), nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if code := errorCode(t, rec); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package avatar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var (
+	secrets *sealer
+	tokens  tokenStore
+)
+
+// errNoToken is returned by tokenStore.get for unknown keys.
+var errNoToken = errors.New("tokens: not found")
+
+// tokenStore keeps OAuth tokens, encrypted at rest.
+type tokenStore interface {
+	put(key string, v interface{}) error
+	get(key string, v interface{}) error
+	delete(key string) error
+}
+
+// fileTokenStore keeps every token in its own file in dir. File names are
+// hashes of the key, so they don't reveal whose token it is.
+type fileTokenStore struct {
+	dir    string
+	sealer *sealer
+}
+
+func newFileTokenStore(dir string, s *sealer) (*fileTokenStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileTokenStore{dir: dir, sealer: s}, nil
+}
+
+func (s *fileTokenStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *fileTokenStore) put(key string, v interface{}) error {
+	sealed, err := s.sealer.seal("token:"+key, v)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sealed), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(key))
+}
+
+func (s *fileTokenStore) get(key string, v interface{}) error {
+	sealed, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoToken
+	}
+	if err != nil {
+		return err
+	}
+	return s.sealer.open("token:"+key, string(sealed), v)
+}
+
+func (s *fileTokenStore) delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoToken
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package avatar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// Trace exporters for Config.TraceExporter.
+const (
+	exporterNone   = "none"
+	exporterOTLP   = "otlp"
+	exporterStdout = "stdout"
+)
+
+var (
+	tracer = otel.Tracer("github.com/kiwiidb/mastodon-in-twitter-avatar/api")
+
+	//client for upstream calls, propagates the trace context
+	upstreamClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport,
+		otelhttp.WithTracerProvider(redactingTracerProvider{}))}
+
+	//client for hosts named by users, such as Mastodon instances and badge
+	//URLs: https only and never to a private or loopback address
+	fediverseClient = &http.Client{Transport: otelhttp.NewTransport(newPublicTransport(),
+		otelhttp.WithTracerProvider(redactingTracerProvider{}))}
+
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// setupTracing installs the global tracer provider and propagator for the
+// configured exporter.
+func setupTracing(conf *Config) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.TraceExporter {
+	case exporterNone:
+		return nil
+	case exporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case exporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.OTLPEndpoint)}
+		if conf.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return fmt.Errorf("config: unknown TraceExporter %q", conf.TraceExporter)
+	}
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.TraceSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(conf.ServiceName))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	return nil
+}
+
+// Shutdown flushes the spans that are still buffered.
+func Shutdown(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// redactingTracerProvider hands out the global tracers, but with the URL
+// attributes of client spans redacted while usernames are hashed: upstream
+// URLs carry the screen name or handle being looked up.
+type redactingTracerProvider struct{ embedded.TracerProvider }
+
+func (redactingTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return redactingTracer{otel.GetTracerProvider().Tracer(name, opts...)}
+}
+
+type redactingTracer struct{ trace.Tracer }
+
+func (t redactingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	if !hashUsernames {
+		return ctx, span
+	}
+	span = redactingSpan{span}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type redactingSpan struct{ trace.Span }
+
+func (s redactingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	attrs := make([]attribute.KeyValue, len(kv))
+	for i, a := range kv {
+		if a.Key == semconv.URLFullKey || a.Key == "http.url" {
+			a = a.Key.String(redactURL(a.Value.AsString()))
+		}
+		attrs[i] = a
+	}
+	s.Span.SetAttributes(attrs...)
+}
+
+// redactURL blanks the query values and any "@user" path segment of raw.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "REDACTED"
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "@") {
+			segments[i] = "@REDACTED"
+		}
+	}
+	u.Path, u.RawPath = strings.Join(segments, "/"), ""
+	q := u.Query()
+	for k := range q {
+		q[k] = []string{"REDACTED"}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// traced starts a server span for every request served by h.
+func traced(operation string, h http.HandlerFunc) http.HandlerFunc {
+	return otelhttp.NewHandler(h, operation).ServeHTTP
+}
+
+// stage is one step of a render. It is traced, measured and logged.
+type stage struct {
+	ctx   context.Context
+	name  string
+	start time.Time
+	span  trace.Span
+}
+
+// startStage begins the named stage as a child span of ctx.
+func startStage(ctx context.Context, name string) (context.Context, *stage) {
+	ctx, span := tracer.Start(ctx, name)
+	return ctx, &stage{ctx: ctx, name: name, start: time.Now(), span: span}
+}
+
+// end records the duration and outcome of the stage.
+func (s *stage) end(err error) {
+	d := time.Since(s.start)
+	observeStage(s.name, d)
+	log := loggerFrom(s.ctx)
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, errorClass(err))
+		log.Warn("stage failed", append([]any{"stage", s.name, "duration", d}, errorAttrs(err)...)...)
+	} else {
+		log.Debug("stage done", "stage", s.name, "duration", d)
+	}
+	s.span.End()
+}
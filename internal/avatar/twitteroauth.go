@@ -0,0 +1,337 @@
+package avatar
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+)
+
+const (
+	twitterStateCookie = "twitter_oauth"
+	oauthStateTTL      = 10 * time.Minute
+)
+
+var (
+	publicURL      string
+	twitterOAuth   *oauth1.Config
+	twitterAPIBase string
+	secureCookies  bool
+
+	resultPage = template.Must(template.New("result").Parse(
+		`<!doctype html><meta charset="utf-8"><title>{{.Title}}</title><h1>{{.Title}}</h1><p>{{.Message}}</p>`))
+)
+
+// twitterState is the OAuth state kept in a sealed cookie between the login
+// redirect and the callback. Options are the render options of the login
+// request, checked by parseRenderOptions before they are sealed.
+type twitterState struct {
+	RequestToken  string
+	RequestSecret string
+	Action        string
+	Options       url.Values
+	Expires       time.Time
+}
+
+// twitterToken is a user's access token, as kept in the token store.
+type twitterToken struct {
+	UserID     string
+	ScreenName string
+	Token      string
+	Secret     string
+}
+
+// newTwitterOAuth configures the OAuth 1.0a user-context flow. The app's
+// client credentials double as its consumer key and secret.
+func newTwitterOAuth(conf *Config) *oauth1.Config {
+	return &oauth1.Config{
+		ConsumerKey:    conf.ClientID,
+		ConsumerSecret: conf.ClientSecret,
+		CallbackURL:    strings.TrimSuffix(conf.PublicURL, "/") + "/api/twitter/callback",
+		Endpoint: oauth1.Endpoint{
+			RequestTokenURL: conf.TwitterOAuthBase + "/oauth/request_token",
+			AuthorizeURL:    conf.TwitterOAuthBase + "/oauth/authorize",
+			AccessTokenURL:  conf.TwitterOAuthBase + "/oauth/access_token",
+		},
+		HTTPClient: upstreamClient,
+	}
+}
+
+// TwitterLogin starts "Sign in with Twitter" and redirects to Twitter.
+func TwitterLogin(w http.ResponseWriter, r *http.Request) {
+	serve("twitter_login", serveTwitterLogin)(w, r)
+}
+
+// TwitterCallback finishes the sign in, renders the badged avatar and sets
+// it as the user's Twitter profile image.
+func TwitterCallback(w http.ResponseWriter, r *http.Request) {
+	serve("twitter_callback", serveTwitterCallback)(w, r)
+}
+
+func serveTwitterLogin(w http.ResponseWriter, r *http.Request) {
+	if err := applyEnabled(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	action, err := parseAction(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	//fail before the round trip to Twitter rather than in the callback
+	options := r.URL.Query()
+	options.Del("action")
+	if _, err := parseRenderOptions(options); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	requestToken, requestSecret, err := twitterOAuth.RequestToken()
+	if err != nil {
+		writeError(w, r, errTwitterOAuth(err))
+		return
+	}
+	state, err := secrets.seal(twitterStateCookie, twitterState{
+		RequestToken:  requestToken,
+		RequestSecret: requestSecret,
+		Action:        action,
+		Options:       options,
+		Expires:       time.Now().Add(oauthStateTTL),
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setStateCookie(w, twitterStateCookie, "/api/twitter", state)
+	authURL, err := twitterOAuth.AuthorizationURL(requestToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, authURL.String(), http.StatusFound)
+}
+
+func serveTwitterCallback(w http.ResponseWriter, r *http.Request) {
+	if err := applyEnabled(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("denied") != "" {
+		writePage(w, http.StatusForbidden, "Nothing changed", "You did not authorize the app, your avatar was left alone.")
+		return
+	}
+	requestToken, verifier, err := oauth1.ParseAuthorizationCallback(r)
+	if err != nil {
+		writeError(w, r, errOAuthState(err))
+		return
+	}
+	var state twitterState
+	if err := readStateCookie(r, twitterStateCookie, &state); err != nil || state.RequestToken != requestToken {
+		writeError(w, r, errOAuthState(err))
+		return
+	}
+	clearStateCookie(w, twitterStateCookie, "/api/twitter")
+
+	accessToken, accessSecret, err := twitterOAuth.AccessToken(requestToken, state.RequestSecret, verifier)
+	if err != nil {
+		writeError(w, r, errTwitterOAuth(err))
+		return
+	}
+	api := newTwitterUserAPI(r.Context(), accessToken, accessSecret)
+	usr, err := api.verifyCredentials(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	token := twitterToken{UserID: usr.IDStr, ScreenName: usr.ScreenName, Token: accessToken, Secret: accessSecret}
+	if err := tokens.put("twitter:"+usr.IDStr, token); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if state.Action == actionRevert {
+		revertTwitterAvatar(w, r, api, usr)
+		return
+	}
+	if err := backupAvatar(r.Context(), "twitter", usr.IDStr, usr.ScreenName, originalAvatarURL(usr)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	opts, err := parseRenderOptions(state.Options)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	png, err := renders.do(r.Context(), cacheKey(usr.ScreenName)+opts.key(), func(ctx context.Context) ([]byte, error) {
+		return renderUser(ctx, usr, opts)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := api.updateProfileImage(r.Context(), png); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loggerFrom(r.Context()).Info("applied avatar", "platform", "twitter", "username", logUser(usr.ScreenName))
+	writePage(w, http.StatusOK, "Done", fmt.Sprintf("The badged avatar is now the profile image of @%s.", usr.ScreenName))
+}
+
+// revertTwitterAvatar puts the backed up original avatar back.
+func revertTwitterAvatar(w http.ResponseWriter, r *http.Request, api *twitterUserAPI, usr *twitter.User) {
+	backup, err := loadBackup("twitter", usr.IDStr)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := api.updateProfileImage(r.Context(), backup.Image); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := dropBackup("twitter", usr.IDStr); err != nil {
+		loggerFrom(r.Context()).Warn("dropping avatar backup failed", "error", err)
+	}
+	loggerFrom(r.Context()).Info("reverted avatar", "platform", "twitter", "username", logUser(usr.ScreenName))
+	writePage(w, http.StatusOK, "Done", fmt.Sprintf("@%s has its original profile image back.", usr.ScreenName))
+}
+
+// twitterUserAPI calls the Twitter API on behalf of a signed in user.
+type twitterUserAPI struct {
+	client *http.Client
+}
+
+func newTwitterUserAPI(ctx context.Context, token, secret string) *twitterUserAPI {
+	ctx = context.WithValue(ctx, oauth1.HTTPClient, upstreamClient)
+	return &twitterUserAPI{client: twitterOAuth.Client(ctx, oauth1.NewToken(token, secret))}
+}
+
+func (a *twitterUserAPI) verifyCredentials(ctx context.Context) (*twitter.User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, twitterAPIBase+"/1.1/account/verify_credentials.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	usr := &twitter.User{}
+	if err := a.do(req, usr); err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+func (a *twitterUserAPI) updateProfileImage(ctx context.Context, img []byte) error {
+	form := url.Values{"image": {base64.StdEncoding.EncodeToString(img)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, twitterAPIBase+"/1.1/account/update_profile_image.json",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(req, nil)
+}
+
+// do sends req and decodes a successful JSON response into v, if set.
+func (a *twitterUserAPI) do(req *http.Request, v interface{}) error {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return upstreamError(err, errTwitterOAuth)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return &apiError{
+			Status:  http.StatusUnauthorized,
+			Code:    "twitter_token_revoked",
+			Message: "Twitter no longer accepts the sign in, please sign in again.",
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &apiError{
+			Status:     http.StatusTooManyRequests,
+			Code:       "rate_limited",
+			Message:    "Twitter is rate limiting us, try again later.",
+			RetryAfter: rateLimitReset(resp),
+		}
+	case resp.StatusCode != http.StatusOK:
+		return errTwitterOAuth(fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// applyEnabled fails unless the profile update flows are configured.
+func applyEnabled() error {
+	if configErr != nil {
+		return errMisconfigured(configErr)
+	}
+	if secrets == nil || tokens == nil {
+		return &apiError{Status: http.StatusNotFound, Code: "apply_disabled", Message: "Applying avatars is not enabled."}
+	}
+	return nil
+}
+
+func setStateCookie(w http.ResponseWriter, name, path, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearStateCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: path, MaxAge: -1, HttpOnly: true, Secure: secureCookies})
+}
+
+// readStateCookie opens the sealed OAuth state cookie into v and checks it
+// has not expired.
+func readStateCookie(r *http.Request, name string, v interface{ expired() bool }) error {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	if err := secrets.open(name, c.Value, v); err != nil {
+		return err
+	}
+	if v.expired() {
+		return fmt.Errorf("oauth state expired")
+	}
+	return nil
+}
+
+func (s *twitterState) expired() bool {
+	return time.Now().After(s.Expires)
+}
+
+func errOAuthState(err error) error {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    "invalid_oauth_state",
+		Message: "The sign in could not be completed, please start over.",
+		Err:     err,
+	}
+}
+
+func errTwitterOAuth(err error) error {
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Code:    "twitter_oauth_failed",
+		Message: "Signing in with Twitter failed.",
+		Err:     err,
+	}
+}
+
+func writePage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	resultPage.Execute(w, struct{ Title, Message string }{title, message})
+}
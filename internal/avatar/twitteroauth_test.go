@@ -0,0 +1,190 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/koding/multiconfig"
+)
+
+// testConfig is the default config with the Twitter app credentials and
+// token encryption set, pointing Twitter at base.
+func testConfig(t *testing.T, base string) *Config {
+	t.Helper()
+	conf := new(Config)
+	if err := (&multiconfig.TagLoader{}).Load(conf); err != nil {
+		t.Fatal(err)
+	}
+	conf.ClientID, conf.ClientSecret = "client", "secret"
+	conf.TokenUrl = base + "/oauth2/token"
+	conf.TwitterOAuthBase, conf.TwitterAPIBase = base, base
+	conf.PublicURL = "http://localhost"
+	conf.TokenEncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	conf.TokenStoreDir = t.TempDir()
+	return conf
+}
+
+// useConfig configures the package from conf for the duration of the test.
+func useConfig(t *testing.T, conf *Config) {
+	t.Helper()
+	oldErr := configErr
+	if err := configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	configErr = nil
+	t.Cleanup(func() { configErr = oldErr })
+}
+
+// fakeTwitter stands in for the Twitter OAuth endpoints, the user API and the
+// avatar CDN, and keeps the profile images it is sent.
+type fakeTwitter struct {
+	*httptest.Server
+	mu       sync.Mutex
+	uploaded [][]byte
+}
+
+func newFakeTwitter(t *testing.T) *fakeTwitter {
+	ft := &fakeTwitter{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/request_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("oauth_token=request-token&oauth_token_secret=request-secret&oauth_callback_confirmed=true"))
+	})
+	mux.HandleFunc("/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("oauth_token=access-token&oauth_token_secret=access-secret"))
+	})
+	mux.HandleFunc("/1.1/account/verify_credentials.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ft.user())
+	})
+	mux.HandleFunc("/avatar.png", func(w http.ResponseWriter, r *http.Request) {
+		img := image.NewRGBA(image.Rect(0, 0, 400, 400))
+		for i := range img.Pix {
+			img.Pix[i] = 0x80
+		}
+		png.Encode(w, img)
+	})
+	mux.HandleFunc("/1.1/account/update_profile_image.json", func(w http.ResponseWriter, r *http.Request) {
+		img, err := base64.StdEncoding.DecodeString(r.PostFormValue("image"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ft.mu.Lock()
+		ft.uploaded = append(ft.uploaded, img)
+		ft.mu.Unlock()
+		w.Write([]byte("{}"))
+	})
+	ft.Server = httptest.NewServer(mux)
+	t.Cleanup(ft.Close)
+	return ft
+}
+
+func (ft *fakeTwitter) user() *twitter.User {
+	return &twitter.User{IDStr: "12", ScreenName: "jack", ProfileImageURLHttps: ft.URL + "/avatar_normal.png"}
+}
+
+func TestTwitterLoginCallbackAppliesOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantLogin   int
+		wantCode    string
+		wantOptions url.Values
+	}{
+		{name: "defaults", wantLogin: http.StatusFound, wantOptions: url.Values{}},
+		{
+			name:        "badge and caption",
+			query:       "badge=twitter&caption=Now+on+Mastodon",
+			wantLogin:   http.StatusFound,
+			wantOptions: url.Values{"badge": {"twitter"}, "caption": {"Now on Mastodon"}},
+		},
+		{name: "invalid badge", query: "badge=myspace", wantLogin: http.StatusBadRequest, wantCode: "invalid_option"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFakeTwitter(t)
+			useConfig(t, testConfig(t, ft.URL))
+
+			//login: seals the options and sends the user to Twitter
+			rec := httptest.NewRecorder()
+			TwitterLogin(rec, httptest.NewRequest(http.MethodGet, "/api/twitter/login?"+tt.query, nil))
+			if rec.Code != tt.wantLogin {
+				t.Fatalf("login status = %d, want %d: %s", rec.Code, tt.wantLogin, rec.Body)
+			}
+			if code := errorCode(t, rec); code != tt.wantCode {
+				t.Fatalf("login code = %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, ft.URL+"/oauth/authorize?oauth_token=request-token") {
+				t.Fatalf("login redirects to %q", loc)
+			}
+			cookies := rec.Result().Cookies()
+
+			//callback: renders with the sealed options and uploads the result
+			req := httptest.NewRequest(http.MethodGet, "/api/twitter/callback?oauth_token=request-token&oauth_verifier=verifier", nil)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			rec = httptest.NewRecorder()
+			TwitterCallback(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("callback status = %d: %s", rec.Code, rec.Body)
+			}
+			if len(ft.uploaded) != 1 {
+				t.Fatalf("%d profile images uploaded, want 1", len(ft.uploaded))
+			}
+
+			opts, err := parseRenderOptions(tt.wantOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := renderUser(context.Background(), ft.user(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ft.uploaded[0], want) {
+				t.Error("uploaded image was not rendered with the login options")
+			}
+			img, err := png.Decode(bytes.NewReader(ft.uploaded[0]))
+			if err != nil {
+				t.Fatalf("uploaded image: %v", err)
+			}
+			if img.At(0, 0) == (color.RGBA{}) {
+				t.Error("uploaded image is empty")
+			}
+		})
+	}
+}
+
+func TestTwitterCallbackRejectsForeignState(t *testing.T) {
+	ft := newFakeTwitter(t)
+	useConfig(t, testConfig(t, ft.URL))
+
+	rec := httptest.NewRecorder()
+	TwitterLogin(rec, httptest.NewRequest(http.MethodGet, "/api/twitter/login", nil))
+	req := httptest.NewRequest(http.MethodGet, "/api/twitter/callback?oauth_token=other-token&oauth_verifier=verifier", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	TwitterCallback(rec, req)
+	if code := errorCode(t, rec); code != "invalid_oauth_state" {
+		t.Errorf("code = %q, want invalid_oauth_state", code)
+	}
+	if len(ft.uploaded) != 0 {
+		t.Error("profile image was changed")
+	}
+}
@@ -0,0 +1,112 @@
+package avatar
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/image/vector"
+)
+
+// twitterLink matches links to Twitter profiles, in plain text or in the
+// href of a Mastodon profile field. The host must start the link, so
+// lookalikes such as dropbox.com/jack or notx.com/jack don't count.
+var twitterLink = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])(?:https?://)?(?:www\.|mobile\.)?(?:twitter|x)\.com/(?:#!/)?@?([a-z0-9_]{1,15})\b`)
+
+// verification says whether a Twitter account and a Fediverse account
+// point at each other, which is as close to proof of a common owner as we
+// can get without either signing in.
+type verification struct {
+	Handle                string `json:"handle"`
+	Verified              bool   `json:"verified"`
+	TwitterLinksFediverse bool   `json:"twitter_links_fediverse"`
+	FediverseLinksTwitter bool   `json:"fediverse_links_twitter"`
+	//Status is verificationChecked, or verificationUnknown when the
+	//instance could not be asked; Error is then the code of the failure
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Outcomes of a verification.
+const (
+	verificationChecked = "checked"
+	verificationUnknown = "unknown"
+)
+
+// verifyHandle checks that the profile of usr mentions h, going by the
+// handles found in it, and that the account of h links back to usr from
+// its profile fields or bio. When the instance can't be reached it returns
+// the error along with what it could check, marked verificationUnknown.
+func verifyHandle(ctx context.Context, usr *twitter.User, h fediHandle, candidates []handleCandidate) (*verification, error) {
+	v := &verification{Handle: h.String(), Status: verificationChecked}
+	v.TwitterLinksFediverse = slices.ContainsFunc(candidates, func(c handleCandidate) bool {
+		return strings.EqualFold(c.Handle, h.String())
+	})
+	if !v.TwitterLinksFediverse {
+		//no need to ask the instance
+		return v, nil
+	}
+	acct, err := lookupMastodonAccount(ctx, h)
+	if errorClass(err) == "fediverse_account_not_found" {
+		//a definite answer: nothing links back
+		v.Error = errorClass(err)
+		return v, nil
+	}
+	if err != nil {
+		v.Status, v.Error = verificationUnknown, errorClass(err)
+		return v, err
+	}
+	v.FediverseLinksTwitter = linksTwitter(acct, usr.ScreenName)
+	v.Verified = v.TwitterLinksFediverse && v.FediverseLinksTwitter
+	return v, nil
+}
+
+// linksTwitter reports whether acct links to the Twitter profile of
+// screenName. Mastodon marks every profile field link rel="me", so a link
+// in a field is the rel="me" link; links in the bio count as well.
+func linksTwitter(acct *mastodonAccount, screenName string) bool {
+	texts := []string{acct.Note}
+	for _, f := range acct.Fields {
+		texts = append(texts, f.Value)
+	}
+	for _, text := range texts {
+		for _, sub := range twitterLink.FindAllStringSubmatch(text, -1) {
+			if strings.EqualFold(sub[1], screenName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifiedBadge returns a copy of badge with a check mark in a green disc
+// over its top right corner.
+func verifiedBadge(badge image.Image) image.Image {
+	b := badge.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), badge, b.Min, draw.Src)
+
+	r := b.Dx() / 5
+	center := image.Pt(b.Dx()-r, r)
+	//white rim, so the disc stands out on the badge
+	draw.DrawMask(img, img.Bounds(), image.White, image.Point{}, &circle{center, r}, image.Point{}, draw.Over)
+	draw.DrawMask(img, img.Bounds(), &image.Uniform{color.RGBA{0x17, 0xbf, 0x63, 0xff}}, image.Point{},
+		&circle{center, r * 85 / 100}, image.Point{}, draw.Over)
+
+	//check mark as a polygon, in units of r around the center
+	s, cx, cy := float32(r), float32(center.X), float32(center.Y)
+	points := [][2]float32{{-0.5, 0}, {-0.15, 0.35}, {0.5, -0.3}, {0.38, -0.42}, {-0.15, 0.11}, {-0.38, -0.12}}
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	z.MoveTo(cx+points[0][0]*s, cy+points[0][1]*s)
+	for _, p := range points[1:] {
+		z.LineTo(cx+p[0]*s, cy+p[1]*s)
+	}
+	z.ClosePath()
+	z.Draw(img, img.Bounds(), image.White, image.Point{})
+	return img
+}
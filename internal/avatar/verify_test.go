@@ -0,0 +1,79 @@
+package avatar
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestVerifyHandle(t *testing.T) {
+	usr := &twitter.User{ScreenName: "jack"}
+	tests := []struct {
+		name       string
+		handle     fediHandle
+		candidates []handleCandidate
+		wantErr    bool
+		want       verification
+	}{
+		{
+			name:   "not mentioned in the profile",
+			handle: fediHandle{User: "jack", Instance: "mastodon.social"},
+			want:   verification{Handle: "jack@mastodon.social", Status: verificationChecked},
+		},
+		{
+			//localhost is never dialed, so the instance can't be asked
+			name:       "instance unreachable",
+			handle:     fediHandle{User: "jack", Instance: "localhost"},
+			candidates: []handleCandidate{{Handle: "jack@localhost"}},
+			wantErr:    true,
+			want: verification{Handle: "jack@localhost", TwitterLinksFediverse: true,
+				Status: verificationUnknown, Error: "address_not_allowed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := verifyHandle(context.Background(), usr, tt.handle, tt.candidates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyHandle() error = %v, want error %v", err, tt.wantErr)
+			}
+			if v == nil || *v != tt.want {
+				t.Errorf("verifyHandle() = %+v, want %+v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinksTwitter(t *testing.T) {
+	tests := []struct {
+		name string
+		note string
+		link string
+		want bool
+	}{
+		{name: "profile field", link: `<a href="https://twitter.com/jack" rel="me">twitter.com/jack</a>`, want: true},
+		{name: "x.com in bio", note: "<p>also at x.com/@Jack</p>", want: true},
+		{name: "www and mobile hosts", note: "<p>www.twitter.com/jack, mobile.x.com/jack</p>", want: true},
+		{name: "other account", link: "https://twitter.com/jackdorsey"},
+		{name: "lookalike host", link: "https://dropbox.com/jack"},
+		{name: "lookalike host in bio", note: "<p>notx.com/jack</p>"},
+		{name: "subdomain of another host", link: "https://evil.twitter.com/jack"},
+		{name: "lookalike prefix", note: "<p>my-x.com/jack</p>"},
+		{name: "nothing", note: "<p>hello</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acct := &mastodonAccount{Note: tt.note}
+			if tt.link != "" {
+				acct.Fields = append(acct.Fields, struct {
+					Name       string  `json:"name"`
+					Value      string  `json:"value"`
+					VerifiedAt *string `json:"verified_at"`
+				}{Name: "Twitter", Value: tt.link})
+			}
+			if got := linksTwitter(acct, "jack"); got != tt.want {
+				t.Errorf("linksTwitter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}